@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var accessible bool // Screen-reader friendly output, set by --accessible or the config
+
+// speakerLabel names who sent a message and when, in local time
+func speakerLabel(speaker, sent string) string {
+	t, ok := parseMessageTime(sent)
+	if !ok {
+		t = time.Now()
+	}
+	return fmt.Sprintf("%s at %s", speaker, t.Local().Format("15:04"))
+}
+
+// numberedMenu lists the Nomis as a numbered list and reads the choice as a
+// number or a name, asking again until the answer is valid.
+func numberedMenu(nomis []Nomi, in io.Reader, out io.Writer) (Nomi, error) {
+	fmt.Fprintln(out, "Select a Nomi to chat with:")
+	for i, nomi := range nomis {
+		fmt.Fprintf(out, "%d. %s (%s)\n", i+1, nomi.Name, nomi.RelationshipType)
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "Enter a number from 1 to %d, or q to quit: ", len(nomis))
+		line, err := reader.ReadString('\n')
+		answer := strings.TrimSpace(line)
+
+		if strings.EqualFold(answer, "q") {
+			return Nomi{}, fmt.Errorf("no Nomi selected")
+		}
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(nomis) {
+			return nomis[n-1], nil
+		}
+		if nomi, ok := findNomi(nomis, answer); ok {
+			return nomi, nil
+		}
+		if err != nil {
+			return Nomi{}, fmt.Errorf("no Nomi selected")
+		}
+		fmt.Fprintf(out, "%q is not in the list.\n", answer)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNumberedMenu(t *testing.T) {
+	nomis := []Nomi{
+		{UUID: "123", Name: "Alice", RelationshipType: "Friend"},
+		{UUID: "456", Name: "Bob", RelationshipType: "Mentor"},
+	}
+
+	var out bytes.Buffer
+	nomi, err := numberedMenu(nomis, strings.NewReader("7\nbob\n"), &out)
+	if err != nil || nomi.UUID != "456" {
+		t.Errorf("Expected Bob after an invalid answer, got %+v (%v)", nomi, err)
+	}
+	for _, line := range []string{"1. Alice (Friend)", "2. Bob (Mentor)", `"7" is not in the list.`} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected output to contain %q, got %q", line, out.String())
+		}
+	}
+
+	if nomi, err := numberedMenu(nomis, strings.NewReader("1"), io.Discard); err != nil || nomi.UUID != "123" {
+		t.Errorf("Expected Alice, got %+v (%v)", nomi, err)
+	}
+	if _, err := numberedMenu(nomis, strings.NewReader("q\n"), io.Discard); err == nil {
+		t.Error("Expected an error when quitting")
+	}
+	if _, err := numberedMenu(nomis, strings.NewReader(""), io.Discard); err == nil {
+		t.Error("Expected an error when input ends")
+	}
+}
+
+func TestSpeakerLabel(t *testing.T) {
+	sent := time.Date(2024, 5, 1, 14, 30, 0, 0, time.Local)
+	if label := speakerLabel("Alice", sent.Format(time.RFC3339)); label != "Alice at 14:30" {
+		t.Errorf("Expected \"Alice at 14:30\", got %q", label)
+	}
+	if label := speakerLabel("You", ""); !strings.HasPrefix(label, "You at ") {
+		t.Errorf("Expected the current time for a missing timestamp, got %q", label)
+	}
+}
+
+func TestWaitForAccessible(t *testing.T) {
+	accessible = true
+	defer func() { accessible = false }()
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	done := waitFor("Waiting for reply…", "Reply received")
+	done()
+
+	w.Close()
+	os.Stdout = oldStdout
+	out, _ := io.ReadAll(r)
+	if string(out) != "Waiting for reply…\nReply received\n" {
+		t.Errorf("Expected plain status lines, got %q", out)
+	}
+}
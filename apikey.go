@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+var apiKeyFile string // Read the API key from this file
+var apiKeyStdin bool  // Read the API key from the first line of stdin
+
+// firstLine returns the first non-empty line of s, trimmed, so that
+// trailing newlines and extra lines (as printed by `pass show`) are ignored.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// readAPIKeyFile reads the API key from a file
+func readAPIKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading API key file: %w", err)
+	}
+	key := firstLine(string(data))
+	if key == "" {
+		return "", fmt.Errorf("API key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// readLine reads a line from r one byte at a time, so that no input past
+// the newline is buffered away from the next reader of stdin
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			if len(line) == 0 {
+				return "", err
+			}
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(string(line)), nil
+}
+
+// readAPIKeyLine reads the API key from the first line of r, leaving the
+// rest of the input for commands that read stdin.
+func readAPIKeyLine(r io.Reader) (string, error) {
+	key, err := readLine(r)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("error reading API key from stdin: %w", err)
+	}
+	if key == "" {
+		return "", fmt.Errorf("no API key found on stdin")
+	}
+	return key, nil
+}
+
+// runAPIKeyCommand runs the configured command through the shell and uses its output as the key
+func runAPIKeyCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.Stdin = os.Stdin // Password managers may prompt for their own passphrase
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("api_key_command %q failed: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	key := firstLine(string(out))
+	if key == "" {
+		return "", fmt.Errorf("api_key_command %q printed no API key", command)
+	}
+	return key, nil
+}
+
+// resolveAPIKey finds the API key and reports where it came from. Sources
+// are tried in order: the --api-key, --api-key-file and --api-key-stdin
+// flags (at most one of them), NOMI_API_KEY, NOMI_API_KEY_FILE, the
+// api_key_command config entry, and finally the key stored by `auth login`.
+// An empty key with no error means none was found.
+func resolveAPIKey() (key, source string, err error) {
+	var flags []string
+	if apiKey != "" {
+		flags = append(flags, "--api-key")
+	}
+	if apiKeyFile != "" {
+		flags = append(flags, "--api-key-file")
+	}
+	if apiKeyStdin {
+		flags = append(flags, "--api-key-stdin")
+	}
+	if len(flags) > 1 {
+		return "", "", fmt.Errorf("only one of --api-key, --api-key-file and --api-key-stdin may be used, got %s", strings.Join(flags, " and "))
+	}
+
+	switch {
+	case apiKey != "":
+		return apiKey, "--api-key flag", nil
+	case apiKeyFile != "":
+		key, err := readAPIKeyFile(apiKeyFile)
+		return key, "--api-key-file " + apiKeyFile, err
+	case apiKeyStdin:
+		key, err := readAPIKeyLine(os.Stdin)
+		return key, "stdin", err
+	}
+
+	if key := os.Getenv("NOMI_API_KEY"); key != "" {
+		return key, "NOMI_API_KEY environment variable", nil
+	}
+	if path := os.Getenv("NOMI_API_KEY_FILE"); path != "" {
+		key, err := readAPIKeyFile(path)
+		return key, "NOMI_API_KEY_FILE " + path, err
+	}
+	if config.APIKeyCommand != "" {
+		key, err := runAPIKeyCommand(config.APIKeyCommand)
+		return key, "api_key_command", err
+	}
+
+	return loadStoredAPIKey()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestReadAPIKeyLine(t *testing.T) {
+	r := strings.NewReader("  stdin-key \nrest of input")
+	key, err := readAPIKeyLine(r)
+	if err != nil || key != "stdin-key" {
+		t.Errorf("Expected stdin-key, got %q (%v)", key, err)
+	}
+
+	rest := make([]byte, 64)
+	n, _ := r.Read(rest)
+	if string(rest[:n]) != "rest of input" {
+		t.Errorf("Expected the remaining input to be left unread, got %q", rest[:n])
+	}
+
+	if _, err := readAPIKeyLine(strings.NewReader("\n")); err == nil {
+		t.Error("Expected an error for empty input")
+	}
+}
+
+func TestResolveAPIKey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("api_key_command tests use a POSIX shell")
+	}
+	keyring.MockInit()
+	t.Setenv("NOMI_DATA_DIR", t.TempDir())
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	os.WriteFile(keyFile, []byte("file-key\n"), 0600)
+	envKeyFile := filepath.Join(dir, "env-key")
+	os.WriteFile(envKeyFile, []byte("env-file-key\n"), 0600)
+	emptyFile := filepath.Join(dir, "empty")
+	os.WriteFile(emptyFile, nil, 0600)
+
+	originalConfig := config
+	defer func() {
+		config = originalConfig
+		apiKey, apiKeyFile, apiKeyStdin = "", "", false
+	}()
+
+	tests := []struct {
+		name           string
+		flagKey        string
+		flagFile       string
+		envKey         string
+		envFile        string
+		command        string
+		expectedKey    string
+		expectedSource string
+		expectedError  string
+	}{
+		{name: "flag beats everything", flagKey: "flag-key", envKey: "env-key", command: "echo cmd-key", expectedKey: "flag-key", expectedSource: "--api-key flag"},
+		{name: "file flag beats env", flagFile: keyFile, envKey: "env-key", expectedKey: "file-key", expectedSource: "--api-key-file"},
+		{name: "env beats env file", envKey: "env-key", envFile: envKeyFile, expectedKey: "env-key", expectedSource: "NOMI_API_KEY"},
+		{name: "env file beats command", envFile: envKeyFile, command: "echo cmd-key", expectedKey: "env-file-key", expectedSource: "NOMI_API_KEY_FILE"},
+		{name: "command output first line", command: "printf 'cmd-key\\nurl: example.com\\n'", expectedKey: "cmd-key", expectedSource: "api_key_command"},
+		{name: "nothing found", expectedKey: "", expectedSource: ""},
+		{name: "conflicting flags", flagKey: "flag-key", flagFile: keyFile, expectedError: "only one of"},
+		{name: "empty file", flagFile: emptyFile, expectedError: "is empty"},
+		{name: "missing file", envFile: filepath.Join(dir, "missing"), expectedError: "error reading API key file"},
+		{name: "failing command", command: "echo oops >&2; exit 3", expectedError: "oops"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			apiKey, apiKeyFile, apiKeyStdin = tc.flagKey, tc.flagFile, false
+			t.Setenv("NOMI_API_KEY", tc.envKey)
+			t.Setenv("NOMI_API_KEY_FILE", tc.envFile)
+			config = &Config{APIKeyCommand: tc.command}
+
+			key, source, err := resolveAPIKey()
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					t.Errorf("Expected error containing %q, got %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if key != tc.expectedKey || !strings.HasPrefix(source, tc.expectedSource) {
+				t.Errorf("Expected %q from %q, got %q from %q", tc.expectedKey, tc.expectedSource, key, source)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archivePrefix starts the name of the encrypted files holding the messages
+// of each conversation, with a Nomi or in a room
+const archivePrefix = "messages-"
+
+// Speakers of an archived message
+const (
+	speakerUser = "user"
+	speakerNomi = "nomi"
+)
+
+// archivedMessage is a message sent to or received from a Nomi, kept in
+// the local conversation archive. Room messages carry the room, and the
+// Nomi only when one wrote them.
+type archivedMessage struct {
+	NomiUUID string  `json:"nomiUuid"`
+	NomiName string  `json:"nomiName"`
+	RoomUUID string  `json:"roomUuid,omitempty"`
+	RoomName string  `json:"roomName,omitempty"`
+	Speaker  string  `json:"speaker"` // speakerUser or speakerNomi
+	Message  Message `json:"message"`
+}
+
+// conversation returns the UUID and name of the room the message was
+// exchanged in, or of its Nomi for a one-to-one chat
+func (m archivedMessage) conversation() (uuid, name string) {
+	if m.RoomUUID != "" {
+		return m.RoomUUID, m.RoomName
+	}
+	return m.NomiUUID, m.NomiName
+}
+
+// sameConversation reports whether two messages were exchanged in the same
+// one-to-one chat or room
+func (m archivedMessage) sameConversation(other archivedMessage) bool {
+	a, _ := m.conversation()
+	b, _ := other.conversation()
+	return a == b
+}
+
+// speakerName returns who wrote the message, as shown in transcripts
+func (m archivedMessage) speakerName() string {
+	if m.Speaker == speakerUser {
+		return "You"
+	}
+	return m.NomiName
+}
+
+// sent returns when the message was sent, or the zero time if unknown
+func (m archivedMessage) sent() time.Time {
+	t, _ := parseMessageTime(m.Message.Sent)
+	return t
+}
+
+// archiveMu serializes archive writes from concurrent requests, e.g. in serve
+var archiveMu sync.Mutex
+
+// openArchive opens the encrypted store up front when messages are
+// archived, so the passphrase is asked for before a chat or server starts
+// rather than in the middle of it.
+func openArchive() error {
+	if !config.Archive.Enabled {
+		return nil
+	}
+	_, err := openStore()
+	return err
+}
+
+// archiveExchange adds both sides of an exchange with a Nomi to the archive
+func archiveExchange(nomi Nomi, chatResponse *ChatResponse) error {
+	return appendToArchive(
+		archivedMessage{NomiUUID: nomi.UUID, NomiName: nomi.Name, Speaker: speakerUser, Message: chatResponse.SentMessage},
+		archivedMessage{NomiUUID: nomi.UUID, NomiName: nomi.Name, Speaker: speakerNomi, Message: chatResponse.ReplyMessage},
+	)
+}
+
+// appendToArchive adds messages to the file of their conversation when
+// the archive is enabled
+func appendToArchive(messages ...archivedMessage) error {
+	if !config.Archive.Enabled {
+		return nil
+	}
+	s, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	for _, message := range messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		uuid, _ := message.conversation()
+		if err := s.appendRecord(archivePrefix+uuid, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadArchive reads every archived message, grouped by conversation and oldest first
+func loadArchive(s *secureStore) ([]archivedMessage, error) {
+	names, err := s.list(archivePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []archivedMessage
+	for _, name := range names {
+		records, err := s.readRecords(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			var message archivedMessage
+			if err := json.Unmarshal(record, &message); err != nil {
+				return nil, fmt.Errorf("error parsing %s: %w", name, err)
+			}
+			messages = append(messages, message)
+		}
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		ci, _ := messages[i].conversation()
+		cj, _ := messages[j].conversation()
+		if ci != cj {
+			return ci < cj
+		}
+		return messages[i].sent().Before(messages[j].sent())
+	})
+	return messages, nil
+}
+
+// archiveExists reports whether any messages were archived, without
+// needing the storage key
+func archiveExists() bool {
+	dir, err := dataDir()
+	if err != nil {
+		return false
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), archivePrefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// setupArchiveTest enables the archive in a fresh data directory
+func setupArchiveTest(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("NOMI_DATA_DIR", t.TempDir())
+	t.Setenv("NOMI_PASSPHRASE", "correct horse")
+	store = nil
+	oldConfig := config
+	config = &Config{Archive: ArchiveConfig{Enabled: true}}
+	t.Cleanup(func() {
+		store = nil
+		config = oldConfig
+	})
+}
+
+// archiveMessages writes messages straight to the archive
+func archiveMessages(t *testing.T, messages ...archivedMessage) {
+	s, err := openStore()
+	if err != nil {
+		t.Fatalf("Error opening store: %v", err)
+	}
+	for _, message := range messages {
+		data, _ := json.Marshal(message)
+		uuid, _ := message.conversation()
+		if err := s.appendRecord(archivePrefix+uuid, data); err != nil {
+			t.Fatalf("Error archiving message: %v", err)
+		}
+	}
+}
+
+func TestSendMessageArchivesExchange(t *testing.T) {
+	setupArchiveTest(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(ChatResponse{
+			SentMessage:  Message{UUID: "sent-1", Text: req.MessageText, Sent: "2026-10-19T10:00:00Z"},
+			ReplyMessage: Message{UUID: "reply-1", Text: "Lisbon sounds lovely", Sent: "2026-10-19T10:00:02Z"},
+		})
+	}))
+	defer server.Close()
+	client = NewNomiClient("test-api-key", server.URL)
+
+	if archiveExists() {
+		t.Fatal("Expected no archive before the first message")
+	}
+	if _, err := sendMessage("chat", Nomi{UUID: "uuid-alice", Name: "Alice"}, "I booked the trip"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !archiveExists() {
+		t.Fatal("Expected the archive to be created")
+	}
+
+	messages, err := loadArchive(store)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 archived messages, got %d", len(messages))
+	}
+	if messages[0].Speaker != speakerUser || messages[0].Message.Text != "I booked the trip" || messages[0].speakerName() != "You" {
+		t.Errorf("Expected the sent message first, got %+v", messages[0])
+	}
+	if messages[1].Speaker != speakerNomi || messages[1].NomiName != "Alice" || messages[1].speakerName() != "Alice" {
+		t.Errorf("Expected the reply second, got %+v", messages[1])
+	}
+}
+
+func TestRoomMessagesAreArchived(t *testing.T) {
+	setupArchiveTest(t)
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	room := Room{UUID: "room-1", Name: "Alice only"}
+	alice := Nomi{UUID: "a11ce000-0000-4000-8000-000000000000", Name: "Alice"}
+	if _, err := sendRoomMessage("mcp", room, "Lisbon next week?"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := requestRoomReply("mcp", room, alice); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	messages, err := loadArchive(store)
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("Expected 2 archived messages, got %d (%v)", len(messages), err)
+	}
+	if messages[0].speakerName() != "You" || messages[1].speakerName() != "Alice" || !messages[0].sameConversation(messages[1]) {
+		t.Errorf("Expected both messages in the room's conversation, got %+v", messages)
+	}
+
+	// Search and stats see the room as a conversation of its own
+	node, _, _ := parseQuery("lisbon")
+	if hits := searchMessages(messages, node, searchFilter{nomi: "alice only"}); len(hits) != 1 {
+		t.Errorf("Expected the room message to be found, got %v", hits)
+	}
+	if stats := statsByNomi(messages, 0, time.Now()); len(stats) != 1 || stats[0].NomiName != "Alice only" || stats[0].Messages != 2 {
+		t.Errorf("Expected the room's stats, got %+v", stats)
+	}
+}
+
+func TestArchiveDisabled(t *testing.T) {
+	setupArchiveTest(t)
+	config.Archive.Enabled = false
+
+	response := &ChatResponse{SentMessage: Message{UUID: "sent-1"}, ReplyMessage: Message{UUID: "reply-1"}}
+	if err := archiveExchange(Nomi{UUID: "uuid-alice"}, response); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := openArchive(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if store != nil || archiveExists() {
+		t.Error("Expected nothing to be archived when the archive is disabled")
+	}
+}
+
+func TestLoadArchiveOrder(t *testing.T) {
+	setupArchiveTest(t)
+	archiveMessages(t,
+		archivedMessage{NomiUUID: "uuid-bob", NomiName: "Bob", Speaker: speakerUser, Message: Message{UUID: "b1", Sent: "2026-10-18T09:00:00Z"}},
+		archivedMessage{NomiUUID: "uuid-alice", NomiName: "Alice", Speaker: speakerNomi, Message: Message{UUID: "a2", Sent: "2026-10-19T09:00:00Z"}},
+		archivedMessage{NomiUUID: "uuid-alice", NomiName: "Alice", Speaker: speakerUser, Message: Message{UUID: "a1", Sent: "2026-10-17T09:00:00Z"}},
+	)
+
+	messages, err := loadArchive(store)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var order []string
+	for _, message := range messages {
+		order = append(order, message.Message.UUID)
+	}
+	if len(order) != 3 || order[0] != "a1" || order[1] != "a2" || order[2] != "b1" {
+		t.Errorf("Expected messages grouped by Nomi, oldest first, got %v", order)
+	}
+}
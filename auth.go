@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+// Keyring entry holding the API key
+const (
+	keyringService = "nomi-cli"
+	keyringUser    = "api-key"
+)
+
+// credentialsFile is the passphrase-encrypted fallback for machines without a keyring
+const credentialsFile = "credentials.age"
+
+// credentialsWorkFactor is the scrypt cost (log2 N) used to derive keys from passphrases
+var credentialsWorkFactor = 18
+
+var authUseFile bool // Store the key in the encrypted file even if a keyring is available
+
+// readSecret, when set, reads secrets instead of the terminal, e.g. through
+// the chat's line editor which owns stdin while a session runs.
+var readSecret func(prompt string) (string, error)
+
+// promptSecret reads a line without echo when stdin is a terminal, so it
+// stays out of the screen and shell history; piped input is read as is.
+func promptSecret(prompt string) (string, error) {
+	if readSecret != nil {
+		return readSecret(prompt)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		secret, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return strings.TrimSpace(string(secret)), err
+	}
+
+	// Piped input may hold several secrets, one per line
+	return readLine(os.Stdin)
+}
+
+// readPassphrase returns the passphrase from NOMI_PASSPHRASE, or prompts for it
+func readPassphrase(prompt string, confirm bool) (string, error) {
+	if passphrase := os.Getenv("NOMI_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+
+	passphrase, err := promptSecret(prompt)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase cannot be empty")
+	}
+	if confirm {
+		again, err := promptSecret("Confirm passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+// encryptWithPassphrase encrypts data with a scrypt-derived age key
+func encryptWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving key from passphrase: %w", err)
+	}
+	recipient.SetWorkFactor(credentialsWorkFactor)
+
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting: %w", err)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("error encrypting: %w", err)
+	}
+	return encrypted.Bytes(), nil
+}
+
+// decryptWithPassphrase reverses encryptWithPassphrase
+func decryptWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("error deriving key from passphrase: %w", err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), identity)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting (wrong passphrase?): %w", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting: %w", err)
+	}
+	return plaintext, nil
+}
+
+// saveCredentialsFile encrypts the API key with a passphrase into the data directory
+func saveCredentialsFile(key, passphrase string) (string, error) {
+	path, err := dataPath(credentialsFile)
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := encryptWithPassphrase([]byte(key), passphrase)
+	if err != nil {
+		return "", fmt.Errorf("error encrypting credentials: %w", err)
+	}
+	if err := os.WriteFile(path, encrypted, 0600); err != nil {
+		return "", fmt.Errorf("error writing credentials: %w", err)
+	}
+	return path, nil
+}
+
+// loadCredentialsFile decrypts the API key from the credentials file
+func loadCredentialsFile(path, passphrase string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading credentials: %w", err)
+	}
+
+	key, err := decryptWithPassphrase(data, passphrase)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting credentials: %w", err)
+	}
+	return string(key), nil
+}
+
+// credentialsFileExists returns the credentials file path if it exists
+func credentialsFileExists() (string, bool) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", false
+	}
+	path := filepath.Join(dir, credentialsFile)
+	_, err = os.Stat(path)
+	return path, err == nil
+}
+
+// loadStoredAPIKey returns the API key saved by `auth login` and where it
+// came from, or an empty key if none is stored.
+func loadStoredAPIKey() (key, source string, err error) {
+	key, err = keyring.Get(keyringService, keyringUser)
+	if err == nil {
+		return key, "system keyring", nil
+	}
+
+	path, ok := credentialsFileExists()
+	if !ok {
+		return "", "", nil
+	}
+	passphrase, err := readPassphrase("Passphrase for the encrypted credentials file: ", false)
+	if err != nil {
+		return "", "", err
+	}
+	key, err = loadCredentialsFile(path, passphrase)
+	if err != nil {
+		return "", "", err
+	}
+	return key, "encrypted file " + path, nil
+}
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage the stored Nomi.ai API key",
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:         "login",
+	Short:       "Verify an API key and store it in the system keyring or an encrypted file",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		key, err := promptSecret("Nomi.ai API key: ")
+		if err != nil {
+			fmt.Println("Error reading API key:", err)
+			return
+		}
+		if key == "" {
+			fmt.Println("No API key entered")
+			return
+		}
+
+		if _, err := NewNomiClient(key, baseURL).GetNomis(); err != nil {
+			fmt.Println("Error verifying API key:", err)
+			return
+		}
+
+		if !authUseFile {
+			err := keyring.Set(keyringService, keyringUser, key)
+			if err == nil {
+				fmt.Println("API key verified and stored in the system keyring")
+				return
+			}
+			fmt.Printf("System keyring unavailable (%v), using an encrypted file instead\n", err)
+		}
+
+		passphrase, err := readPassphrase("Passphrase for the encrypted credentials file: ", true)
+		if err != nil {
+			fmt.Println("Error reading passphrase:", err)
+			return
+		}
+		path, err := saveCredentialsFile(key, passphrase)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("API key verified and stored encrypted in %s\n", path)
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:         "status",
+	Short:       "Show where the API key comes from and whether it works",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		key, source, err := resolveAPIKey()
+		if err != nil {
+			fmt.Println("Error loading API key:", err)
+			return
+		}
+		if key == "" {
+			fmt.Println("Not logged in: run 'nomi-cli auth login'")
+			return
+		}
+
+		fmt.Printf("API key from %s\n", source)
+		if _, err := NewNomiClient(key, baseURL).GetNomis(); err != nil {
+			fmt.Println("API key is not valid:", err)
+			return
+		}
+		fmt.Println("API key is valid")
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:         "logout",
+	Short:       "Remove the stored API key",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		removed := false
+		if err := keyring.Delete(keyringService, keyringUser); err == nil {
+			fmt.Println("Removed API key from the system keyring")
+			removed = true
+		}
+		if path, ok := credentialsFileExists(); ok {
+			if err := os.Remove(path); err != nil {
+				fmt.Println("Error removing credentials file:", err)
+				return
+			}
+			fmt.Printf("Removed encrypted credentials file %s\n", path)
+			removed = true
+		}
+		if !removed {
+			fmt.Println("No stored API key found")
+		}
+	},
+}
+
+func init() {
+	authLoginCmd.Flags().BoolVar(&authUseFile, "file", false, "Store the key in a passphrase-encrypted file instead of the system keyring")
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authStatusCmd)
+	authCmd.AddCommand(authLogoutCmd)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func init() {
+	// Keep key derivation fast in tests
+	credentialsWorkFactor = 10
+}
+
+func TestCredentialsFileRoundTrip(t *testing.T) {
+	t.Setenv("NOMI_DATA_DIR", t.TempDir())
+
+	path, err := saveCredentialsFile("my-api-key", "correct horse")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "my-api-key") {
+		t.Error("Expected the key to be encrypted on disk")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600, got %v", info.Mode().Perm())
+	}
+
+	key, err := loadCredentialsFile(path, "correct horse")
+	if err != nil || key != "my-api-key" {
+		t.Errorf("Expected the stored key, got %q (%v)", key, err)
+	}
+	if _, err := loadCredentialsFile(path, "wrong"); err == nil {
+		t.Error("Expected an error for a wrong passphrase")
+	}
+}
+
+func TestLoadStoredAPIKey(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("NOMI_DATA_DIR", t.TempDir())
+	t.Setenv("NOMI_PASSPHRASE", "correct horse")
+
+	if key, _, err := loadStoredAPIKey(); err != nil || key != "" {
+		t.Errorf("Expected no stored key, got %q (%v)", key, err)
+	}
+
+	if _, err := saveCredentialsFile("file-key", "correct horse"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if key, source, err := loadStoredAPIKey(); err != nil || key != "file-key" || !strings.HasPrefix(source, "encrypted file") {
+		t.Errorf("Expected the key from the encrypted file, got %q from %q (%v)", key, source, err)
+	}
+
+	keyring.Set(keyringService, keyringUser, "keyring-key")
+	if key, source, err := loadStoredAPIKey(); err != nil || key != "keyring-key" || source != "system keyring" {
+		t.Errorf("Expected the keyring to take precedence, got %q from %q (%v)", key, source, err)
+	}
+}
+
+func TestAuthCommands(t *testing.T) {
+	keyring.MockInit()
+	dir := t.TempDir()
+	t.Setenv("NOMI_DATA_DIR", dir)
+	t.Setenv("NOMI_PASSPHRASE", "correct horse")
+	t.Setenv("NOMI_API_KEY", "")
+
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	baseURL = upstream.URL
+	apiKey = ""
+
+	if out := runCommand(t, authCmd, "wrong-key\n", "login"); !strings.Contains(out, "Error verifying API key") {
+		t.Errorf("Expected verification failure, got %q", out)
+	}
+	if out := runCommand(t, authCmd, "test-api-key\n", "login"); !strings.Contains(out, "stored in the system keyring") {
+		t.Errorf("Expected key stored in keyring, got %q", out)
+	}
+	if out := runCommand(t, authCmd, "", "status"); !strings.Contains(out, "API key from system keyring") || !strings.Contains(out, "API key is valid") {
+		t.Errorf("Unexpected status output %q", out)
+	}
+	if out := runCommand(t, authCmd, "", "logout"); !strings.Contains(out, "Removed API key from the system keyring") {
+		t.Errorf("Expected keyring removal, got %q", out)
+	}
+
+	authUseFile = true
+	defer func() { authUseFile = false }()
+	if out := runCommand(t, authCmd, "test-api-key\n", "login", "--file"); !strings.Contains(out, "stored encrypted in "+filepath.Join(dir, credentialsFile)) {
+		t.Errorf("Expected key stored in encrypted file, got %q", out)
+	}
+	if out := runCommand(t, authCmd, "", "logout"); !strings.Contains(out, "Removed encrypted credentials file") {
+		t.Errorf("Expected file removal, got %q", out)
+	}
+	if out := runCommand(t, authCmd, "", "status"); !strings.Contains(out, "Not logged in") {
+		t.Errorf("Expected logged out status, got %q", out)
+	}
+}
+
+func TestAuthLoginReadsPipedSecrets(t *testing.T) {
+	keyring.MockInit()
+	dir := t.TempDir()
+	t.Setenv("NOMI_DATA_DIR", dir)
+	t.Setenv("NOMI_PASSPHRASE", "")
+	t.Setenv("NOMI_API_KEY", "")
+
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	baseURL = upstream.URL
+	apiKey = ""
+
+	// The key, the passphrase and its confirmation come one per line
+	authUseFile = true
+	defer func() { authUseFile = false }()
+	if out := runCommand(t, authCmd, "test-api-key\ncorrect horse\ncorrect horse\n", "login", "--file"); !strings.Contains(out, "stored encrypted in") {
+		t.Fatalf("Expected key stored in encrypted file, got %q", out)
+	}
+	if key, err := loadCredentialsFile(filepath.Join(dir, credentialsFile), "correct horse"); err != nil || key != "test-api-key" {
+		t.Errorf("Expected the key to be stored with the piped passphrase, got %q (%v)", key, err)
+	}
+}
@@ -2,9 +2,6 @@ package main
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
-	"runtime"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -14,6 +11,11 @@ type ChatRequest struct {
 	MessageText string `json:"messageText"`
 }
 
+// RoomReplyRequest asks a Nomi in a room to reply
+type RoomReplyRequest struct {
+	NomiUUID string `json:"nomiUuid"`
+}
+
 type Message struct {
 	UUID string `json:"uuid"`
 	Text string `json:"text"`
@@ -25,33 +27,6 @@ type ChatResponse struct {
 	ReplyMessage Message `json:"replyMessage"`
 }
 
-const (
-	colorReset  = "\033[0m"
-	colorGreen  = "\033[32m"
-	colorBlue   = "\033[34m"
-	colorYellow = "\033[33m"
-	colorCyan   = "\033[36m"
-)
-
-// clearScreen clears the terminal screen and attempts to clear the scrollback buffer.
-func clearScreen() {
-	switch runtime.GOOS {
-	case "windows":
-		cmd := exec.Command("cmd", "/c", "cls")
-		cmd.Stdout = os.Stdout
-		cmd.Run()
-	default:
-		// First attempt using ANSI escape codes
-		fmt.Print("\033[H\033[2J\033[3J\033c")
-
-		// Fallback to tput if available
-		cmd := exec.Command("tput", "reset")
-		cmd.Stdout = os.Stdout
-		cmd.Run()
-	}
-}
-
-
 // spinner displays a spinning wheel animation while waiting for a response.
 func spinner(stopChan chan bool) {
 	chars := []string{"-", "\\", "|", "/"} // Simple classic spinner
@@ -65,7 +40,7 @@ func spinner(stopChan chan bool) {
 				case <-stopChan:
 					return
 				default:
-					fmt.Printf("\r%s%s%s", colorCyan, char, colorReset)
+					fmt.Printf("\r%s", theme.Accent.Render(char))
 					time.Sleep(100 * time.Millisecond) // Slightly slower rotation
 				}
 			}
@@ -73,12 +48,42 @@ func spinner(stopChan chan bool) {
 	}
 }
 
+// waitFor signals that a response is awaited and returns a function to call
+// once it arrives. It shows a spinner, or in accessible mode prints the
+// waiting and done status lines instead of redrawing the line.
+func waitFor(waiting, done string) func() {
+	if accessible {
+		fmt.Println(waiting)
+		return func() { fmt.Println(done) }
+	}
+
+	stopChan := make(chan bool)
+	go spinner(stopChan)
+	return func() {
+		close(stopChan)
+		fmt.Print("\r") // Clear the spinner line
+	}
+}
+
 var chatCmd = &cobra.Command{
 	Use:   "chat [id]",
 	Short: "Start a live chat session with a specific Nomi",
 	Args:  cobra.ExactArgs(1), // Requires exactly one argument: the Nomi Name
 	Run: func(cmd *cobra.Command, args []string) {
+		if chatTimestamps != "off" && chatTimestamps != "absolute" && chatTimestamps != "relative" {
+			fmt.Printf("Invalid --timestamps value %q: use off, absolute or relative\n", chatTimestamps)
+			return
+		}
+
 		name := args[0]
 		startChat(name)
 	},
 }
+
+var rawOutput bool // Print replies exactly as received, without Markdown rendering
+
+func init() {
+	chatCmd.Flags().BoolVar(&rawOutput, "raw", false, "Print replies as received, without wrapping or Markdown rendering")
+	chatCmd.Flags().StringVar(&chatTimestamps, "timestamps", "off", "Show reply times: off, absolute or relative")
+	chatCmd.Flags().BoolVar(&chatLatency, "latency", false, "Show how long each reply took")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// chatSenderQueueSize is how many messages can be typed ahead of the replies
+const chatSenderQueueSize = 32
+
+// chatSender sends a chat's messages in the background, one at a time and
+// in the order they were typed, so the user can keep typing while a Nomi
+// replies. Replies are written to out as they arrive.
+type chatSender struct {
+	name   string
+	outbox *chatOutbox
+	out    io.Writer
+	typing func(bool) // Shows or hides the "is typing" indicator
+
+	queue chan string
+	done  chan struct{}
+
+	mu      sync.Mutex
+	waiting int           // Messages typed but not answered yet
+	last    *chatExchange // Latest exchange, shown by /details
+}
+
+func newChatSender(name string, outbox *chatOutbox, out io.Writer, typing func(bool)) *chatSender {
+	s := &chatSender{
+		name:   name,
+		outbox: outbox,
+		out:    out,
+		typing: typing,
+		queue:  make(chan string, chatSenderQueueSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// submit queues a message for sending and returns how many earlier
+// messages it waits behind.
+func (s *chatSender) submit(text string) int {
+	s.mu.Lock()
+	ahead := s.waiting
+	s.waiting++
+	s.mu.Unlock()
+
+	s.queue <- text
+	return ahead
+}
+
+// pending returns how many messages have not been answered yet
+func (s *chatSender) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.waiting
+}
+
+// lastExchange returns the latest exchange, or nil before the first reply
+func (s *chatSender) lastExchange() *chatExchange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// close stops accepting messages and waits for the queued ones to be answered
+func (s *chatSender) close() {
+	close(s.queue)
+	<-s.done
+}
+
+func (s *chatSender) run() {
+	defer close(s.done)
+	for text := range s.queue {
+		s.typing(true)
+		start := time.Now()
+		chatResponse, queued, err := s.outbox.send(text)
+		latency := time.Since(start)
+
+		s.mu.Lock()
+		s.waiting--
+		idle := s.waiting == 0
+		if err == nil && !queued {
+			s.last = &chatExchange{Response: chatResponse, Latency: latency}
+		}
+		exchange := s.last
+		s.mu.Unlock()
+
+		// Keep the indicator up while more messages wait for their reply
+		if idle {
+			s.typing(false)
+		}
+
+		if queued {
+			fmt.Fprintf(s.out, "%s: %s\n", theme.User.Render("You (pending)"), text)
+			fmt.Fprintf(s.out, "Message queued (%v); it will be sent automatically, see 'nomi-cli outbox list'\n", err)
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(s.out, "Error sending message %q: %v\n", text, err)
+			continue
+		}
+
+		// Display the reply, with both sides labeled by speaker and time in accessible mode
+		label := s.name
+		if accessible {
+			fmt.Fprintf(s.out, "%s: %s\n", speakerLabel("You", chatResponse.SentMessage.Sent), text)
+			label = speakerLabel(s.name, chatResponse.ReplyMessage.Sent)
+		}
+		label += replyMeta(*exchange, chatTimestamps, chatLatency, time.Now())
+		fmt.Fprintln(s.out, formatReply(label, chatResponse.ReplyMessage.Text, rawOutput))
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// syncBuffer is a bytes.Buffer safe for the sender's goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestChatSenderKeepsOrder(t *testing.T) {
+	// Hold the first reply until the other messages were typed
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.MessageText == "one" {
+			<-release
+		}
+		mu.Lock()
+		received = append(received, req.MessageText)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(ChatResponse{
+			SentMessage:  Message{UUID: "sent-" + req.MessageText},
+			ReplyMessage: Message{UUID: "reply-" + req.MessageText, Text: "Re: " + req.MessageText},
+		})
+	}))
+	defer server.Close()
+	client = NewNomiClient("test-api-key", server.URL)
+	t.Setenv("NOMI_DATA_DIR", t.TempDir())
+
+	var out syncBuffer
+	var typing []bool
+	var typingMu sync.Mutex
+	sender := newChatSender("Alice", newChatOutbox(Nomi{UUID: "uuid-alice", Name: "Alice"}, &out), &out, func(on bool) {
+		typingMu.Lock()
+		typing = append(typing, on)
+		typingMu.Unlock()
+	})
+
+	for i, text := range []string{"one", "two", "three"} {
+		if ahead := sender.submit(text); ahead != i {
+			t.Errorf("Expected %q to wait behind %d messages, got %d", text, i, ahead)
+		}
+	}
+	if pending := sender.pending(); pending != 3 {
+		t.Errorf("Expected 3 pending messages, got %d", pending)
+	}
+	close(release)
+	sender.close()
+
+	if strings.Join(received, ",") != "one,two,three" {
+		t.Errorf("Expected messages sent in order, got %v", received)
+	}
+	output := out.String()
+	if strings.Index(output, "Re: one") > strings.Index(output, "Re: two") || strings.Index(output, "Re: two") > strings.Index(output, "Re: three") {
+		t.Errorf("Expected replies in order, got %q", output)
+	}
+	if last := sender.lastExchange(); last == nil || last.Response.ReplyMessage.UUID != "reply-three" {
+		t.Errorf("Expected the last exchange to be the third one, got %+v", last)
+	}
+
+	// The indicator stays on until the last reply arrives
+	typingMu.Lock()
+	defer typingMu.Unlock()
+	if len(typing) == 0 || typing[len(typing)-1] {
+		t.Errorf("Expected the typing indicator to end hidden, got %v", typing)
+	}
+	hides := 0
+	for _, on := range typing {
+		if !on {
+			hides++
+		}
+	}
+	if hides != 1 {
+		t.Errorf("Expected the indicator to be hidden once, got %v", typing)
+	}
+}
+
+func TestChatSenderReportsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	client = NewNomiClient("test-api-key", server.URL)
+	t.Setenv("NOMI_DATA_DIR", t.TempDir())
+
+	var out syncBuffer
+	sender := newChatSender("Alice", newChatOutbox(Nomi{UUID: "uuid-alice", Name: "Alice"}, &out), &out, func(bool) {})
+	sender.submit("hello")
+	sender.close()
+
+	if !strings.Contains(out.String(), `Error sending message "hello"`) {
+		t.Errorf("Expected the error to be reported, got %q", out.String())
+	}
+	if sender.lastExchange() != nil {
+		t.Error("Expected no exchange to be recorded")
+	}
+}
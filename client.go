@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -37,6 +38,18 @@ func NewNomiClient(apiKey, baseURL string) *NomiClient {
 }
 
 func (c *NomiClient) makeRequest(method, endpoint string, body interface{}, result interface{}) error {
+	return c.makeRequestContext(context.Background(), method, endpoint, body, result)
+}
+
+// makeRequestContext is makeRequest with a context carrying the parent span
+// and retry count of the call
+func (c *NomiClient) makeRequestContext(ctx context.Context, method, endpoint string, body interface{}, result interface{}) (err error) {
+	// Record a span and metrics for the call
+	ctx, span := startRequestSpan(ctx, method, endpoint)
+	start := time.Now()
+	statusCode := 0
+	defer func() { endRequestSpan(span, start, method, endpoint, statusCode, err) }()
+
 	var reqBody *bytes.Buffer
 	if body != nil {
 		jsonData, err := json.Marshal(body)
@@ -48,12 +61,11 @@ func (c *NomiClient) makeRequest(method, endpoint string, body interface{}, resu
 
 	url := fmt.Sprintf("%s%s", c.baseURL, endpoint)
 	var req *http.Request
-	var err error
 
 	if reqBody != nil {
-		req, err = http.NewRequest(method, url, reqBody)
+		req, err = http.NewRequestWithContext(ctx, method, url, reqBody)
 	} else {
-		req, err = http.NewRequest(method, url, nil)
+		req, err = http.NewRequestWithContext(ctx, method, url, nil)
 	}
 
 	if err != nil {
@@ -70,8 +82,10 @@ func (c *NomiClient) makeRequest(method, endpoint string, body interface{}, resu
 		return fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
+	statusCode = resp.StatusCode
 
-	if resp.StatusCode != http.StatusOK {
+	// Creating a room may answer 201 and deleting one 204
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
 		var errorMessage string
 		if bodyBytes, err := io.ReadAll(resp.Body); err == nil && len(bodyBytes) > 0 {
 			errorMessage = fmt.Sprintf("Request to %s failed: %s", endpoint, string(bodyBytes))
@@ -123,10 +137,66 @@ func (c *NomiClient) GetRooms() ([]Room, error) {
 	return response.Rooms, nil
 }
 
+// CreateRoom creates a room with the given settings and members
+func (c *NomiClient) CreateRoom(request RoomRequest) (*Room, error) {
+	var room Room
+	err := c.makeRequest("POST", "/rooms", request, &room)
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// UpdateRoom changes the settings and members of a room
+func (c *NomiClient) UpdateRoom(id string, request RoomRequest) (*Room, error) {
+	var room Room
+	endpoint := fmt.Sprintf("/rooms/%s", id)
+	err := c.makeRequest("PUT", endpoint, request, &room)
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// DeleteRoom deletes a room
+func (c *NomiClient) DeleteRoom(id string) error {
+	endpoint := fmt.Sprintf("/rooms/%s", id)
+	return c.makeRequest("DELETE", endpoint, nil, nil)
+}
+
 func (c *NomiClient) SendMessage(nomiID, message string) (*ChatResponse, error) {
+	return c.SendMessageContext(context.Background(), nomiID, message)
+}
+
+// SendMessageContext is SendMessage with a context for tracing
+func (c *NomiClient) SendMessageContext(ctx context.Context, nomiID, message string) (*ChatResponse, error) {
 	var response ChatResponse
 	endpoint := fmt.Sprintf("/nomis/%s/chat", nomiID)
 	requestBody := ChatRequest{MessageText: message}
+	err := c.makeRequestContext(ctx, "POST", endpoint, requestBody, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// SendRoomMessage posts a message from the user to a room
+func (c *NomiClient) SendRoomMessage(roomID, message string) (*ChatResponse, error) {
+	var response ChatResponse
+	endpoint := fmt.Sprintf("/rooms/%s/chat", roomID)
+	requestBody := ChatRequest{MessageText: message}
+	err := c.makeRequest("POST", endpoint, requestBody, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// RequestRoomReply asks a Nomi in a room to reply to the conversation
+func (c *NomiClient) RequestRoomReply(roomID, nomiID string) (*ChatResponse, error) {
+	var response ChatResponse
+	endpoint := fmt.Sprintf("/rooms/%s/chat/request", roomID)
+	requestBody := RoomReplyRequest{NomiUUID: nomiID}
 	err := c.makeRequest("POST", endpoint, requestBody, &response)
 	if err != nil {
 		return nil, err
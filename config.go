@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Config holds the settings read from the nomi-cli configuration file
+type Config struct {
+	APIKeyCommand string          `json:"api_key_command,omitempty"` // Command printing the API key, e.g. "pass show nomi"
+	Proxy         ProxyConfig     `json:"proxy"`
+	Hooks         []HookConfig    `json:"hooks,omitempty"`
+	Schedules     []Schedule      `json:"schedules,omitempty"`
+	Telemetry     TelemetryConfig `json:"telemetry"`
+	Theme         ThemeConfig     `json:"theme"`
+	Accessible    bool            `json:"accessible,omitempty"`  // Same as --accessible
+	ClearScreen   bool            `json:"clearScreen,omitempty"` // Clear the visible screen before menus and chats
+	History       HistoryConfig   `json:"history"`
+	Archive       ArchiveConfig   `json:"archive"`
+}
+
+// ArchiveConfig controls the local, encrypted archive of conversations
+type ArchiveConfig struct {
+	Enabled bool `json:"enabled,omitempty"` // Keep every message sent and received, for search
+}
+
+// HistoryConfig controls the chat input history kept between sessions
+type HistoryConfig struct {
+	Enabled          bool   `json:"enabled,omitempty"`          // Save input history to disk, encrypted
+	Scope            string `json:"scope,omitempty"`            // "nomi" (default) for one history per Nomi, or "global"
+	MaxSize          int    `json:"maxSize,omitempty"`          // Entries kept, 1000 by default
+	IgnoreDuplicates bool   `json:"ignoreDuplicates,omitempty"` // Keep only the latest copy of a repeated line
+	IgnoreSpace      bool   `json:"ignoreSpace,omitempty"`      // Don't record lines starting with a space
+}
+
+// ThemeConfig selects the color theme of terminal output
+type ThemeConfig struct {
+	Name   string            `json:"name,omitempty"`   // "dark" (default), "light" or "high-contrast"
+	Colors map[string]string `json:"colors,omitempty"` // Per-role overrides, e.g. {"nomi": "#ff79c6"}
+}
+
+// TelemetryConfig configures OpenTelemetry export of client traces and metrics
+type TelemetryConfig struct {
+	Exporter string `json:"exporter,omitempty"` // "otlp", "stdout", or empty to disable
+	Endpoint string `json:"endpoint,omitempty"` // OTLP/HTTP collector address, e.g. "localhost:4318"
+	Insecure bool   `json:"insecure,omitempty"` // Use plain HTTP to reach the collector
+}
+
+// ProxyConfig configures the local API proxy started by `serve --proxy`
+type ProxyConfig struct {
+	Tokens  []ProxyToken `json:"tokens,omitempty"`
+	LogFile string       `json:"logFile,omitempty"`
+}
+
+// ProxyToken is a locally issued credential accepted by the proxy
+type ProxyToken struct {
+	Name      string   `json:"name"`
+	Token     string   `json:"token"`
+	Nomis     []string `json:"nomis,omitempty"`     // Allowed Nomi names or UUIDs; empty allows all
+	RateLimit int      `json:"rateLimit,omitempty"` // Requests per minute; 0 means unlimited
+}
+
+// HookConfig describes a webhook or local executable invoked on chat events
+type HookConfig struct {
+	Events  []string `json:"events,omitempty"`  // Events to deliver, e.g. "message.sent"; empty means all
+	URL     string   `json:"url,omitempty"`     // Webhook receiving the event as a JSON POST
+	Secret  string   `json:"secret,omitempty"`  // Key used to sign webhook bodies with HMAC-SHA256
+	Command string   `json:"command,omitempty"` // Executable receiving the event JSON on stdin
+	Args    []string `json:"args,omitempty"`
+	Sources []string `json:"sources,omitempty"` // Commands whose events are delivered, e.g. "daemon"; empty means all
+}
+
+// Schedule is a message sent to a Nomi by the daemon at times given by a cron expression
+type Schedule struct {
+	ID         string `json:"id"`
+	Nomi       string `json:"nomi"` // Nomi name or UUID
+	Cron       string `json:"cron"`
+	Message    string `json:"message"`
+	Created    string `json:"created"`
+	SkipMissed bool   `json:"skipMissed,omitempty"` // Don't catch up on runs missed while the daemon was down
+}
+
+var config = &Config{} // Global configuration, loaded before each command
+
+// configPath returns the location of the configuration file,
+// honoring the NOMI_CONFIG environment variable.
+func configPath() (string, error) {
+	if path := os.Getenv("NOMI_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating config directory: %w", err)
+	}
+	return filepath.Join(dir, "nomi-cli", "config.json"), nil
+}
+
+// dataDir returns the directory holding local state such as logs and history,
+// honoring the NOMI_DATA_DIR environment variable.
+func dataDir() (string, error) {
+	if dir := os.Getenv("NOMI_DATA_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating data directory: %w", err)
+	}
+	return filepath.Join(dir, "nomi-cli"), nil
+}
+
+// dataPath returns the path of a file in the data directory, creating the directory if needed
+func dataPath(name string) (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("error creating data directory: %w", err)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// loadConfig reads the configuration file; a missing file yields an empty config.
+func loadConfig() (*Config, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config %s: %w", path, err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// saveConfig writes the configuration file, readable by the current user only.
+func saveConfig(cfg *Config) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling config: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creating config directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("error writing config %s: %w", path, err)
+	}
+	return nil
+}
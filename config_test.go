@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	t.Setenv("NOMI_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error for a missing config, got %v", err)
+	}
+	if len(cfg.Proxy.Tokens) != 0 {
+		t.Errorf("Expected an empty config, got %+v", cfg)
+	}
+}
+
+func TestSaveAndLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "config.json")
+	t.Setenv("NOMI_CONFIG", path)
+
+	cfg := &Config{Proxy: ProxyConfig{Tokens: []ProxyToken{{Name: "ci", Token: "secret", Nomis: []string{"Alice"}, RateLimit: 10}}}}
+	if err := saveConfig(cfg); err != nil {
+		t.Fatalf("Expected no error saving config, got %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected config file to exist, got %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected config permissions 0600, got %v", info.Mode().Perm())
+	}
+
+	loaded, err := loadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error loading config, got %v", err)
+	}
+	if len(loaded.Proxy.Tokens) != 1 || loaded.Proxy.Tokens[0].Token != "secret" || loaded.Proxy.Tokens[0].RateLimit != 10 {
+		t.Errorf("Loaded config doesn't match saved values: %+v", loaded)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte("{not json"), 0600)
+	t.Setenv("NOMI_CONFIG", path)
+
+	if _, err := loadConfig(); err == nil {
+		t.Error("Expected an error for an invalid config file")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("Expected an error for %q", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Monday 2024-01-01 10:30 UTC
+	from := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"0 8 * * *", time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17 * * mon-fri", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"0 8 * * 6,7", time.Date(2024, 1, 6, 8, 0, 0, 0, time.UTC)},
+		{"0 0 1 mar *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 15 * fri", time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			cron, err := parseCron(tc.expr)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if next := cron.next(from); !next.Equal(tc.expected) {
+				t.Errorf("Expected %s, got %s", tc.expected, next)
+			}
+		})
+	}
+}
+
+func TestCronNextNeverMatches(t *testing.T) {
+	cron, err := parseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if next := cron.next(time.Now()); !next.IsZero() {
+		t.Errorf("Expected zero time for February 31st, got %s", next)
+	}
+}
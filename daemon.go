@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// daemonLogName is the encrypted file the daemon logs runs to
+const daemonLogName = "daemon.log"
+
+// daemonLockName is the data directory file a running daemon holds locked,
+// so that a second daemon or a storage rekey can tell it is running
+const daemonLockName = "daemon.lock"
+
+// daemonGrace is how late a run may start before it counts as missed
+const daemonGrace = 2 * time.Minute
+
+// daemonState records when each schedule last ran, so missed runs can be
+// detected after the daemon restarts.
+type daemonState struct {
+	LastRun map[string]time.Time `json:"lastRun"`
+}
+
+// daemonLogEntry is a line of the daemon's JSON Lines log
+type daemonLogEntry struct {
+	Time       string   `json:"time"`
+	ScheduleID string   `json:"scheduleId,omitempty"`
+	OutboxID   string   `json:"outboxId,omitempty"` // Queued message sent on retry
+	Nomi       string   `json:"nomi"`
+	Sent       *Message `json:"sent,omitempty"`
+	Reply      *Message `json:"reply,omitempty"`
+	Skipped    bool     `json:"skipped,omitempty"` // Missed run that was not caught up
+	Error      string   `json:"error,omitempty"`
+	Retrying   bool     `json:"retrying,omitempty"` // Failed run that will be tried again
+}
+
+// loadDaemonState reads the daemon state file; a missing file yields an empty state.
+func loadDaemonState(path string) (*daemonState, error) {
+	state := &daemonState{LastRun: map[string]time.Time{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading daemon state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("error parsing daemon state: %w", err)
+	}
+	if state.LastRun == nil {
+		state.LastRun = map[string]time.Time{}
+	}
+	return state, nil
+}
+
+// saveDaemonState writes the daemon state file
+func saveDaemonState(path string, state *daemonState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling daemon state: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("error writing daemon state: %w", err)
+	}
+	return nil
+}
+
+// runSchedule sends a scheduled message and returns the resulting log
+// entry. The run should be tried again when Retrying is set, as the API
+// was unreachable or failing rather than rejecting the message.
+func runSchedule(schedule Schedule, now time.Time) daemonLogEntry {
+	entry := daemonLogEntry{Time: now.UTC().Format(time.RFC3339), ScheduleID: schedule.ID, Nomi: schedule.Nomi}
+
+	nomi, err := resolveNomi(schedule.Nomi)
+	if err != nil {
+		entry.Error, entry.Retrying = err.Error(), retryableError(err)
+		return entry
+	}
+
+	chatResponse, err := sendMessage("daemon", nomi, schedule.Message)
+	if err != nil {
+		entry.Error, entry.Retrying = err.Error(), retryableError(err)
+		return entry
+	}
+
+	entry.Sent = &chatResponse.SentMessage
+	entry.Reply = &chatResponse.ReplyMessage
+	return entry
+}
+
+// runDueSchedules runs every schedule whose next time has come, writing a
+// log entry for each. A run missed during downtime is caught up once,
+// unless the schedule asks to skip missed runs. A run that failed for a
+// retryable reason stays due, so it is tried again on the next pass until
+// it goes through or, for schedules skipping missed runs, becomes missed.
+func runDueSchedules(schedules []Schedule, state *daemonState, now time.Time, logOut io.Writer) {
+	for _, schedule := range schedules {
+		cron, err := parseCron(schedule.Cron)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping schedule %s: %v\n", schedule.ID, err)
+			continue
+		}
+
+		base, ok := state.LastRun[schedule.ID]
+		if !ok {
+			if base, err = time.Parse(time.RFC3339, schedule.Created); err != nil {
+				base = now.Add(-time.Minute)
+			}
+		}
+
+		due := cron.next(base)
+		if due.IsZero() || due.After(now) {
+			continue
+		}
+
+		var entry daemonLogEntry
+		if schedule.SkipMissed && now.Sub(due) > daemonGrace {
+			entry = daemonLogEntry{Time: now.UTC().Format(time.RFC3339), ScheduleID: schedule.ID, Nomi: schedule.Nomi, Skipped: true}
+		} else {
+			entry = runSchedule(schedule, now)
+		}
+		if !entry.Retrying {
+			state.LastRun[schedule.ID] = now
+		}
+
+		data, _ := json.Marshal(entry)
+		fmt.Fprintf(logOut, "%s\n", data)
+	}
+}
+
+// retryOutbox sends the messages queued by chats that lost connectivity,
+// logging each delivery.
+func retryOutbox(store *secureStore, now time.Time, logOut io.Writer) {
+	if !outboxExists() {
+		return
+	}
+	_, err := flushOutbox(store, "daemon", "", func(item outboxItem, chatResponse *ChatResponse) {
+		entry := daemonLogEntry{
+			Time:     now.UTC().Format(time.RFC3339),
+			OutboxID: item.ID,
+			Nomi:     item.NomiName,
+			Sent:     &chatResponse.SentMessage,
+			Reply:    &chatResponse.ReplyMessage,
+		}
+		data, _ := json.Marshal(entry)
+		fmt.Fprintf(logOut, "%s\n", data)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error retrying outbox:", err)
+	}
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run scheduled messages in the background",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		lockPath, err := dataPath(daemonLockName)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		unlock, err := tryLockFile(lockPath)
+		if errors.Is(err, errFileLocked) {
+			fmt.Println("The daemon is already running")
+			return
+		}
+		if err != nil {
+			fmt.Println("Error locking daemon:", err)
+			return
+		}
+		defer unlock()
+
+		statePath, err := dataPath("daemon-state.json")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		state, err := loadDaemonState(statePath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		// Replies are message data, so the log is kept encrypted
+		store, err := openStore()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		logOut := store.writer(daemonLogName)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		fmt.Printf("Daemon started with %d schedules, logging replies to %s (read it with 'nomi-cli daemon log')\n", len(config.Schedules), store.path(daemonLogName))
+		for {
+			// Reload the config so schedule changes apply without a restart
+			if cfg, err := loadConfig(); err != nil {
+				fmt.Fprintln(os.Stderr, "Error reloading config:", err)
+			} else {
+				config = cfg
+			}
+
+			runDueSchedules(config.Schedules, state, time.Now(), logOut)
+			retryOutbox(store, time.Now(), logOut)
+			if err := saveDaemonState(statePath, state); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+
+			// Wake up at the start of the next minute
+			wait := time.Until(time.Now().Truncate(time.Minute).Add(time.Minute))
+			select {
+			case <-ctx.Done():
+				fmt.Println("Daemon stopped")
+				return
+			case <-time.After(wait):
+			}
+		}
+	},
+}
+
+var daemonLogCmd = &cobra.Command{
+	Use:         "log",
+	Short:       "Print the decrypted log of scheduled runs",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := openStore()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		records, err := store.readRecords(daemonLogName)
+		if err != nil {
+			fmt.Println("Error reading daemon log:", err)
+			return
+		}
+		for _, record := range records {
+			fmt.Println(string(record))
+		}
+	},
+}
+
+func init() {
+	daemonCmd.AddCommand(daemonLogCmd)
+}
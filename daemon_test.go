@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// decodeDaemonLog parses the JSON Lines written by runDueSchedules
+func decodeDaemonLog(t *testing.T, log *bytes.Buffer) []daemonLogEntry {
+	var entries []daemonLogEntry
+	scanner := bufio.NewScanner(log)
+	for scanner.Scan() {
+		var entry daemonLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Error decoding log line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRunDueSchedules(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	now := time.Date(2024, 1, 1, 8, 0, 30, 0, time.UTC)
+	schedules := []Schedule{
+		{ID: "due", Nomi: "Alice", Cron: "0 8 * * *", Message: "Good morning", Created: "2023-12-31T12:00:00Z"},
+		{ID: "later", Nomi: "Alice", Cron: "0 9 * * *", Message: "Later", Created: "2023-12-31T12:00:00Z"},
+		{ID: "missed", Nomi: "Alice", Cron: "0 6 * * *", Message: "Missed", Created: "2023-12-31T12:00:00Z", SkipMissed: true},
+		{ID: "caught-up", Nomi: "Alice", Cron: "0 6 * * *", Message: "Catch up", Created: "2023-12-31T12:00:00Z"},
+		{ID: "broken", Nomi: "Nobody", Cron: "0 8 * * *", Message: "Hi", Created: "2023-12-31T12:00:00Z"},
+	}
+	state := &daemonState{LastRun: map[string]time.Time{}}
+
+	var log bytes.Buffer
+	runDueSchedules(schedules, state, now, &log)
+	entries := decodeDaemonLog(t, &log)
+
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 log entries, got %+v", entries)
+	}
+	if entries[0].ScheduleID != "due" || entries[0].Reply == nil || entries[0].Reply.Text != "Hello there friend" {
+		t.Errorf("Expected the due schedule to record its reply, got %+v", entries[0])
+	}
+	if entries[1].ScheduleID != "missed" || !entries[1].Skipped || entries[1].Sent != nil {
+		t.Errorf("Expected the missed run to be skipped, got %+v", entries[1])
+	}
+	if entries[2].ScheduleID != "caught-up" || entries[2].Reply == nil {
+		t.Errorf("Expected the missed run to be caught up, got %+v", entries[2])
+	}
+	if entries[3].ScheduleID != "broken" || entries[3].Error == "" {
+		t.Errorf("Expected an error for an unknown Nomi, got %+v", entries[3])
+	}
+	if _, ok := state.LastRun["later"]; ok {
+		t.Error("Expected the later schedule not to have run")
+	}
+
+	// Nothing runs again within the same minute
+	log.Reset()
+	runDueSchedules(schedules, state, now.Add(10*time.Second), &log)
+	if log.Len() != 0 {
+		t.Errorf("Expected no runs on the second pass, got %s", log.String())
+	}
+}
+
+func TestRunDueSchedulesRetriesOutages(t *testing.T) {
+	failing := true
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/nomis" {
+			json.NewEncoder(w).Encode(NomiResponse{Nomis: []Nomi{{UUID: "a11ce000-0000-4000-8000-000000000000", Name: "Alice"}}})
+			return
+		}
+		json.NewEncoder(w).Encode(ChatResponse{ReplyMessage: Message{Text: "Back online"}})
+	}))
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	now := time.Date(2024, 1, 1, 8, 0, 30, 0, time.UTC)
+	schedules := []Schedule{{ID: "due", Nomi: "Alice", Cron: "0 8 * * *", Message: "Good morning", Created: "2023-12-31T12:00:00Z"}}
+	state := &daemonState{LastRun: map[string]time.Time{}}
+
+	var log bytes.Buffer
+	runDueSchedules(schedules, state, now, &log)
+	entries := decodeDaemonLog(t, &log)
+	if len(entries) != 1 || entries[0].Error == "" || !entries[0].Retrying {
+		t.Fatalf("Expected a failed run to be retried, got %+v", entries)
+	}
+	if _, ok := state.LastRun["due"]; ok {
+		t.Fatal("Expected a failed run to stay due")
+	}
+
+	// The next pass delivers it once the API is back
+	failing = false
+	log.Reset()
+	runDueSchedules(schedules, state, now.Add(time.Minute), &log)
+	entries = decodeDaemonLog(t, &log)
+	if len(entries) != 1 || entries[0].Reply == nil || entries[0].Reply.Text != "Back online" {
+		t.Fatalf("Expected the retried run to be delivered, got %+v", entries)
+	}
+	if _, ok := state.LastRun["due"]; !ok {
+		t.Error("Expected the delivered run to be recorded")
+	}
+}
+
+func TestDaemonStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "daemon-state.json")
+
+	state, err := loadDaemonState(path)
+	if err != nil || len(state.LastRun) != 0 {
+		t.Fatalf("Expected an empty state for a missing file, got %+v (%v)", state, err)
+	}
+
+	ran := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	state.LastRun["abc"] = ran
+	if err := saveDaemonState(path, state); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	loaded, err := loadDaemonState(path)
+	if err != nil || !loaded.LastRun["abc"].Equal(ran) {
+		t.Errorf("Expected last run %s, got %+v (%v)", ran, loaded, err)
+	}
+}
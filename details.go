@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var chatTimestamps string // Show reply times: off, absolute or relative
+var chatLatency bool      // Show how long each reply took
+
+// chatExchange is a message sent during a chat and the reply it got
+type chatExchange struct {
+	Response *ChatResponse
+	Latency  time.Duration // Round trip measured by the client
+}
+
+// parseMessageTime parses a message timestamp as sent by the API
+func parseMessageTime(sent string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339Nano, sent)
+	return t, err == nil
+}
+
+// formatTimestamp formats a message time for display in the local time zone,
+// either as a clock time (with the date when not today) or relative to now.
+func formatTimestamp(t time.Time, mode string, now time.Time) string {
+	if mode == "relative" {
+		age := now.Sub(t)
+		switch {
+		case age < time.Minute:
+			return "just now"
+		case age < time.Hour:
+			return fmt.Sprintf("%dm ago", int(age.Minutes()))
+		case age < 24*time.Hour:
+			return fmt.Sprintf("%dh ago", int(age.Hours()))
+		default:
+			return fmt.Sprintf("%dd ago", int(age.Hours()/24))
+		}
+	}
+
+	t = t.Local()
+	if y, m, d := t.Date(); y != now.Local().Year() || m != now.Local().Month() || d != now.Local().Day() {
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return t.Format("15:04:05")
+}
+
+// formatLatency rounds a duration for display
+func formatLatency(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// replyMeta returns the enabled timestamp and latency of a reply, e.g.
+// " [14:03:12 · 1.2s]", or an empty string when both are off.
+func replyMeta(exchange chatExchange, mode string, latency bool, now time.Time) string {
+	var parts []string
+	if mode == "absolute" || mode == "relative" {
+		if t, ok := parseMessageTime(exchange.Response.ReplyMessage.Sent); ok {
+			parts = append(parts, formatTimestamp(t, mode, now))
+		}
+	}
+	if latency {
+		parts = append(parts, formatLatency(exchange.Latency))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(parts, " · ") + "]"
+}
+
+// printDetails writes the delivery metadata of an exchange, for matching
+// messages with the Nomi app or reporting bugs.
+func printDetails(w io.Writer, exchange *chatExchange) {
+	if exchange == nil {
+		fmt.Fprintln(w, "No messages sent yet")
+		return
+	}
+
+	for _, m := range []struct {
+		label   string
+		message Message
+	}{
+		{"Sent message", exchange.Response.SentMessage},
+		{"Reply message", exchange.Response.ReplyMessage},
+	} {
+		fmt.Fprintf(w, "%s:\n", m.label)
+		fmt.Fprintf(w, "- UUID: %s\n", m.message.UUID)
+		if t, ok := parseMessageTime(m.message.Sent); ok {
+			fmt.Fprintf(w, "- Sent: %s (%s)\n", t.Local().Format(time.RFC3339), m.message.Sent)
+		} else {
+			fmt.Fprintf(w, "- Sent: %s\n", m.message.Sent)
+		}
+	}
+	fmt.Fprintf(w, "Round trip: %s\n", formatLatency(exchange.Latency))
+}
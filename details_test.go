@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	now := time.Date(2024, 5, 1, 14, 30, 0, 0, time.Local)
+
+	tests := []struct {
+		sent     time.Time
+		mode     string
+		expected string
+	}{
+		{now.Add(-20 * time.Second), "relative", "just now"},
+		{now.Add(-5 * time.Minute), "relative", "5m ago"},
+		{now.Add(-3 * time.Hour), "relative", "3h ago"},
+		{now.Add(-50 * time.Hour), "relative", "2d ago"},
+		{now.Add(-5 * time.Minute), "absolute", "14:25:00"},
+		{now.AddDate(0, 0, -1), "absolute", "2024-04-30 14:30:00"},
+	}
+	for _, test := range tests {
+		if got := formatTimestamp(test.sent, test.mode, now); got != test.expected {
+			t.Errorf("formatTimestamp(%v, %s): expected %q, got %q", test.sent, test.mode, test.expected, got)
+		}
+	}
+}
+
+func TestReplyMeta(t *testing.T) {
+	now := time.Date(2024, 5, 1, 14, 30, 0, 0, time.Local)
+	exchange := chatExchange{
+		Response: &ChatResponse{ReplyMessage: Message{Sent: now.Add(-2 * time.Second).Format(time.RFC3339Nano)}},
+		Latency:  1234 * time.Millisecond,
+	}
+
+	if meta := replyMeta(exchange, "off", false, now); meta != "" {
+		t.Errorf("Expected no metadata, got %q", meta)
+	}
+	if meta := replyMeta(exchange, "absolute", true, now); meta != " [14:29:58 · 1.2s]" {
+		t.Errorf("Expected time and latency, got %q", meta)
+	}
+	if meta := replyMeta(exchange, "relative", false, now); meta != " [just now]" {
+		t.Errorf("Expected a relative time, got %q", meta)
+	}
+}
+
+func TestPrintDetails(t *testing.T) {
+	var out bytes.Buffer
+	printDetails(&out, nil)
+	if !strings.Contains(out.String(), "No messages sent yet") {
+		t.Errorf("Expected a notice without messages, got %q", out.String())
+	}
+
+	out.Reset()
+	printDetails(&out, &chatExchange{
+		Response: &ChatResponse{
+			SentMessage:  Message{UUID: "msg-1", Sent: "2024-05-01T12:00:00Z"},
+			ReplyMessage: Message{UUID: "msg-2", Sent: "2024-05-01T12:00:02Z"},
+		},
+		Latency: 350 * time.Millisecond,
+	})
+	for _, line := range []string{"Sent message:", "- UUID: msg-1", "Reply message:", "- UUID: msg-2", "(2024-05-01T12:00:02Z)", "Round trip: 350ms"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected details to contain %q, got %q", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package main
+
+import "errors"
+
+// errFileLocked is returned by tryLockFile when another process holds the lock
+var errFileLocked = errors.New("locked by another process")
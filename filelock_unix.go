@@ -0,0 +1,39 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on the file at path, waiting for other
+// processes holding it, and returns the function releasing it
+func lockFile(path string) (func(), error) {
+	return flockFile(path, syscall.LOCK_EX)
+}
+
+// tryLockFile is lockFile without waiting: it returns errFileLocked when
+// another process holds the lock
+func tryLockFile(path string) (func(), error) {
+	return flockFile(path, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+func flockFile(path string, how int) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errFileLocked
+		}
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
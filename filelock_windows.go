@@ -0,0 +1,41 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile takes an exclusive lock on the file at path, waiting for other
+// processes holding it, and returns the function releasing it
+func lockFile(path string) (func(), error) {
+	return lockFileEx(path, windows.LOCKFILE_EXCLUSIVE_LOCK)
+}
+
+// tryLockFile is lockFile without waiting: it returns errFileLocked when
+// another process holds the lock
+func tryLockFile(path string) (func(), error) {
+	return lockFileEx(path, windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY)
+}
+
+func lockFileEx(path string, flags uint32) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	overlapped := new(windows.Overlapped)
+	if err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, 1, 0, overlapped); err != nil {
+		f.Close()
+		if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+			return nil, errFileLocked
+		}
+		return nil, err
+	}
+	return func() {
+		windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, overlapped)
+		f.Close()
+	}, nil
+}
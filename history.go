@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+)
+
+// defaultHistorySize is the number of entries kept when maxSize isn't set
+const defaultHistorySize = 1000
+
+// inputHistory is the chat input history, optionally persisted encrypted
+// between sessions. It applies the shell-like rules of the history config.
+type inputHistory struct {
+	cfg   HistoryConfig
+	store *secureStore // Nil when history isn't saved to disk
+	name  string       // Store file holding the history
+	lines []string
+
+	// mirror, when set, receives the entries after each change, so the line
+	// editor's own history follows the same rules as the saved one
+	mirror func(lines []string)
+}
+
+// historyName returns the store file holding a Nomi's input history
+func historyName(cfg HistoryConfig, nomi Nomi) string {
+	if cfg.Scope == "global" {
+		return "history"
+	}
+	return "history-" + nomi.UUID
+}
+
+// openInputHistory loads the saved history of a chat with a Nomi, or
+// starts an in-memory one when persistent history is disabled.
+func openInputHistory(cfg HistoryConfig, nomi Nomi) (*inputHistory, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultHistorySize
+	}
+	h := &inputHistory{cfg: cfg, name: historyName(cfg, nomi)}
+	if !cfg.Enabled {
+		return h, nil
+	}
+
+	s, err := openStore()
+	if err != nil {
+		return h, err
+	}
+	h.store = s
+
+	records, err := s.readRecords(h.name)
+	if err != nil {
+		return h, err
+	}
+	for _, record := range records {
+		h.push(string(record))
+	}
+
+	// Rewrite the file when the rules dropped entries, e.g. after maxSize shrank
+	if len(h.lines) != len(records) {
+		return h, h.save()
+	}
+	return h, nil
+}
+
+// push adds a line to the in-memory history, applying the config rules,
+// and reports whether older entries were dropped.
+func (h *inputHistory) push(line string) (dropped bool) {
+	if h.cfg.IgnoreDuplicates {
+		for i, previous := range h.lines {
+			if previous == line {
+				h.lines = append(h.lines[:i], h.lines[i+1:]...)
+				dropped = true
+				break
+			}
+		}
+	}
+	h.lines = append(h.lines, line)
+	if len(h.lines) > h.cfg.MaxSize {
+		h.lines = h.lines[len(h.lines)-h.cfg.MaxSize:]
+		dropped = true
+	}
+	return dropped
+}
+
+// add records a line typed by the user and reports whether it was kept.
+// Blank lines are never kept, nor lines starting with a space when
+// ignoreSpace is set, so a message can be kept out of the history.
+func (h *inputHistory) add(line string) (bool, error) {
+	if strings.TrimSpace(line) == "" || (h.cfg.IgnoreSpace && strings.HasPrefix(line, " ")) {
+		return false, nil
+	}
+
+	dropped := h.push(line)
+	if h.mirror != nil {
+		h.mirror(h.lines)
+	}
+	if h.store == nil {
+		return true, nil
+	}
+	if dropped {
+		return true, h.save()
+	}
+	return true, h.store.appendRecord(h.name, []byte(line))
+}
+
+// save rewrites the history file with the current entries
+func (h *inputHistory) save() error {
+	records := make([][]byte, len(h.lines))
+	for i, line := range h.lines {
+		records[i] = []byte(line)
+	}
+	return h.store.writeRecords(h.name, records)
+}
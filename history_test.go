@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// setupHistoryTest opens a fresh store for persistent history
+func setupHistoryTest(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("NOMI_DATA_DIR", t.TempDir())
+	t.Setenv("NOMI_PASSPHRASE", "correct horse")
+	store = nil
+	t.Cleanup(func() { store = nil })
+}
+
+func TestInputHistoryPersists(t *testing.T) {
+	setupHistoryTest(t)
+	cfg := HistoryConfig{Enabled: true}
+	alice := Nomi{UUID: "uuid-alice", Name: "Alice"}
+
+	h, err := openInputHistory(cfg, alice)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	h.add("hello")
+	h.add("how are you?")
+	h.add("   ")
+
+	data, _ := os.ReadFile(store.path("history-uuid-alice"))
+	if strings.Contains(string(data), "hello") {
+		t.Error("Expected the history to be encrypted on disk")
+	}
+
+	h, _ = openInputHistory(cfg, alice)
+	if strings.Join(h.lines, "|") != "hello|how are you?" {
+		t.Errorf("Expected the saved history, got %q", h.lines)
+	}
+
+	// Each Nomi has its own history unless it is global
+	if h, _ := openInputHistory(cfg, Nomi{UUID: "uuid-bob"}); len(h.lines) != 0 {
+		t.Errorf("Expected an empty history for another Nomi, got %q", h.lines)
+	}
+	cfg.Scope = "global"
+	h, _ = openInputHistory(cfg, alice)
+	h.add("shared")
+	if h, _ := openInputHistory(cfg, Nomi{UUID: "uuid-bob"}); strings.Join(h.lines, "|") != "shared" {
+		t.Errorf("Expected the global history, got %q", h.lines)
+	}
+}
+
+func TestInputHistoryRules(t *testing.T) {
+	setupHistoryTest(t)
+	cfg := HistoryConfig{Enabled: true, MaxSize: 3, IgnoreDuplicates: true, IgnoreSpace: true}
+	alice := Nomi{UUID: "uuid-alice", Name: "Alice"}
+
+	h, _ := openInputHistory(cfg, alice)
+	for _, line := range []string{"one", "two", "one", " secret", "three", "four"} {
+		h.add(line)
+	}
+	if kept, _ := h.add(" private"); kept {
+		t.Error("Expected a line starting with a space to be ignored")
+	}
+
+	if strings.Join(h.lines, "|") != "one|three|four" {
+		t.Errorf("Expected deduplicated, trimmed history, got %q", h.lines)
+	}
+	h, _ = openInputHistory(cfg, alice)
+	if strings.Join(h.lines, "|") != "one|three|four" {
+		t.Errorf("Expected the same history after reloading, got %q", h.lines)
+	}
+
+	// Shrinking maxSize trims the saved file
+	cfg.MaxSize = 1
+	openInputHistory(cfg, alice)
+	records, _ := store.readRecords("history-uuid-alice")
+	if len(records) != 1 || string(records[0]) != "four" {
+		t.Errorf("Expected the file to be trimmed, got %q", records)
+	}
+}
+
+func TestInputHistoryMirror(t *testing.T) {
+	setupHistoryTest(t)
+	h, _ := openInputHistory(HistoryConfig{MaxSize: 3, IgnoreDuplicates: true}, Nomi{UUID: "uuid-alice"})
+
+	// The line editor's history is rebuilt from the same deduplicated entries
+	var editor []string
+	h.mirror = func(lines []string) { editor = append([]string(nil), lines...) }
+	for _, line := range []string{"one", "two", "one"} {
+		h.add(line)
+	}
+	if strings.Join(editor, "|") != "two|one" {
+		t.Errorf("Expected the in-session history to drop duplicates, got %q", editor)
+	}
+}
+
+func TestInputHistoryDisabled(t *testing.T) {
+	setupHistoryTest(t)
+
+	h, err := openInputHistory(HistoryConfig{}, Nomi{UUID: "uuid-alice"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if kept, err := h.add("hello"); !kept || err != nil {
+		t.Errorf("Expected the line to be kept in memory, got %v (%v)", kept, err)
+	}
+	if store != nil || h.store != nil {
+		t.Error("Expected nothing to be stored when history is disabled")
+	}
+	if h.cfg.MaxSize != defaultHistorySize {
+		t.Errorf("Expected the default size, got %d", h.cfg.MaxSize)
+	}
+}
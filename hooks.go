@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Events delivered to hooks
+const (
+	eventMessageSent     = "message.sent"
+	eventMessageReceived = "message.received"
+	eventSessionStart    = "session.start"
+	eventSessionEnd      = "session.end"
+	eventError           = "error"
+)
+
+// hookTimeout bounds how long a single webhook or executable may run
+const hookTimeout = 10 * time.Second
+
+// hookQueueSize is how many deliveries may wait for the worker; events
+// beyond it are dropped rather than stalling the command that fired them
+const hookQueueSize = 100
+
+// HookEvent is the JSON payload delivered to hooks
+type HookEvent struct {
+	Event    string   `json:"event"`
+	Time     string   `json:"time"`
+	Source   string   `json:"source"` // Command that produced the event
+	NomiUUID string   `json:"nomiUuid,omitempty"`
+	NomiName string   `json:"nomiName,omitempty"`
+	RoomUUID string   `json:"roomUuid,omitempty"`
+	RoomName string   `json:"roomName,omitempty"`
+	Message  *Message `json:"message,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Hooks run in order on a single background worker so chat isn't slowed down
+var (
+	hookQueue   chan hookJob
+	hookPending sync.WaitGroup
+	hookStart   sync.Once
+)
+
+type hookJob struct {
+	hook  HookConfig
+	event HookEvent
+}
+
+// wantsEvent reports whether the hook subscribes to the event
+func (h HookConfig) wantsEvent(event HookEvent) bool {
+	return hookFilterMatches(h.Events, event.Event) && hookFilterMatches(h.Sources, event.Source)
+}
+
+// hookFilterMatches reports whether value is in filter; an empty filter matches everything
+func hookFilterMatches(filter []string, value string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, allowed := range filter {
+		if allowed == value {
+			return true
+		}
+	}
+	return false
+}
+
+// signPayload returns the HMAC-SHA256 signature header value for a webhook body
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// runHook delivers an event to a single webhook and/or executable
+func runHook(hook HookConfig, event HookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling event: %w", err)
+	}
+
+	if hook.URL != "" {
+		req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("error creating webhook request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Nomi-Event", event.Event)
+		if hook.Secret != "" {
+			req.Header.Set("X-Nomi-Signature-256", signPayload(hook.Secret, payload))
+		}
+
+		resp, err := (&http.Client{Timeout: hookTimeout}).Do(req)
+		if err != nil {
+			return fmt.Errorf("error calling webhook %s: %w", hook.URL, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("webhook %s returned %s", hook.URL, resp.Status)
+		}
+	}
+
+	if hook.Command != "" {
+		cmd := exec.Command(hook.Command, hook.Args...)
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), "NOMI_EVENT="+event.Event)
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("error running hook %s: %w", hook.Command, err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("hook %s failed: %w", hook.Command, err)
+			}
+		case <-time.After(hookTimeout):
+			cmd.Process.Kill()
+			return fmt.Errorf("hook %s timed out", hook.Command)
+		}
+	}
+
+	return nil
+}
+
+// fireHook queues an event for every configured hook subscribed to it,
+// without waiting when slow hooks have filled the queue
+func fireHook(event HookEvent) {
+	if event.Time == "" {
+		event.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	for _, hook := range config.Hooks {
+		if !hook.wantsEvent(event) {
+			continue
+		}
+
+		hookStart.Do(func() {
+			hookQueue = make(chan hookJob, hookQueueSize)
+			go func() {
+				for job := range hookQueue {
+					if err := runHook(job.hook, job.event); err != nil {
+						fmt.Fprintln(os.Stderr, "Hook error:", err)
+					}
+					hookPending.Done()
+				}
+			}()
+		})
+
+		hookPending.Add(1)
+		select {
+		case hookQueue <- hookJob{hook: hook, event: event}:
+		default:
+			hookPending.Done()
+			fmt.Fprintf(os.Stderr, "Hook queue full, dropping %s event\n", event.Event)
+		}
+	}
+}
+
+// flushHooks waits for queued hook deliveries to finish
+func flushHooks() {
+	hookPending.Wait()
+}
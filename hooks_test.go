@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHookWantsEvent(t *testing.T) {
+	all := HookConfig{URL: "http://example.com"}
+	if !all.wantsEvent(HookEvent{Event: eventError, Source: "chat"}) {
+		t.Error("Expected a hook without filters to receive everything")
+	}
+
+	some := HookConfig{Events: []string{eventMessageSent, eventSessionEnd}}
+	if !some.wantsEvent(HookEvent{Event: eventSessionEnd}) || some.wantsEvent(HookEvent{Event: eventMessageReceived}) {
+		t.Errorf("Unexpected event filtering for %v", some.Events)
+	}
+
+	daemon := HookConfig{Events: []string{eventMessageReceived}, Sources: []string{"daemon"}}
+	if !daemon.wantsEvent(HookEvent{Event: eventMessageReceived, Source: "daemon"}) || daemon.wantsEvent(HookEvent{Event: eventMessageReceived, Source: "chat"}) {
+		t.Errorf("Unexpected source filtering for %v", daemon.Sources)
+	}
+}
+
+func TestRunHookWebhook(t *testing.T) {
+	var body []byte
+	var signature, eventHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Nomi-Signature-256")
+		eventHeader = r.Header.Get("X-Nomi-Event")
+	}))
+	defer server.Close()
+
+	event := HookEvent{Event: eventMessageSent, Source: "chat", NomiName: "Alice", Message: &Message{UUID: "msg-1", Text: "Hi"}}
+	if err := runHook(HookConfig{URL: server.URL, Secret: "s3cret"}, event); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if eventHeader != eventMessageSent {
+		t.Errorf("Expected X-Nomi-Event %s, got %s", eventMessageSent, eventHeader)
+	}
+	if signature != signPayload("s3cret", body) || !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("Signature %s doesn't match body %s", signature, body)
+	}
+
+	var received HookEvent
+	if err := json.Unmarshal(body, &received); err != nil || received.Message.Text != "Hi" {
+		t.Errorf("Unexpected webhook payload %s (%v)", body, err)
+	}
+}
+
+func TestRunHookWebhookFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := runHook(HookConfig{URL: server.URL}, HookEvent{Event: eventError}); err == nil {
+		t.Error("Expected an error for a failing webhook")
+	}
+}
+
+func TestRunHookCommand(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "event.json")
+	script := filepath.Join(dir, "hook.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\necho \"$NOMI_EVENT\" > \""+out+".name\"\ncat > \""+out+"\"\n"), 0700)
+
+	if err := runHook(HookConfig{Command: script}, HookEvent{Event: eventSessionStart, NomiName: "Alice"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	data, _ := os.ReadFile(out)
+	if !strings.Contains(string(data), `"nomiName":"Alice"`) {
+		t.Errorf("Expected event JSON on stdin, got %q", data)
+	}
+	name, _ := os.ReadFile(out + ".name")
+	if strings.TrimSpace(string(name)) != eventSessionStart {
+		t.Errorf("Expected NOMI_EVENT=%s, got %q", eventSessionStart, name)
+	}
+}
+
+func TestSendMessageFiresHooks(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	var mu sync.Mutex
+	var events []HookEvent
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event HookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = &Config{Hooks: []HookConfig{{URL: webhook.URL}}}
+
+	if _, err := sendMessage("test", Nomi{UUID: "a11ce000-0000-4000-8000-000000000000", Name: "Alice"}, "Hi"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := sendMessage("test", Nomi{UUID: "uuid-missing", Name: "Ghost"}, "Hi"); err == nil {
+		t.Fatal("Expected an error for an unknown Nomi")
+	}
+	flushHooks()
+
+	expected := []string{eventMessageSent, eventMessageReceived, eventError}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %+v", len(expected), events)
+	}
+	for i, name := range expected {
+		if events[i].Event != name || events[i].Source != "test" {
+			t.Errorf("Event %d: expected %s from test, got %+v", i, name, events[i])
+		}
+	}
+	if events[1].Message.Text != "Hello there friend" || events[2].NomiName != "Ghost" {
+		t.Errorf("Unexpected event payloads: %+v", events)
+	}
+}
+
+func TestRoomMessagesFireHooks(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	var mu sync.Mutex
+	var events []HookEvent
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event HookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = &Config{Hooks: []HookConfig{{URL: webhook.URL}}}
+
+	room := Room{UUID: "room-1", Name: "Alice only"}
+	if _, err := sendRoomMessage("test", room, "Hi all"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := requestRoomReply("test", room, Nomi{UUID: "a11ce000-0000-4000-8000-000000000000", Name: "Alice"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	flushHooks()
+
+	if len(events) != 2 || events[0].Event != eventMessageSent || events[1].Event != eventMessageReceived {
+		t.Fatalf("Expected a sent and a received event, got %+v", events)
+	}
+	if events[0].RoomName != "Alice only" || events[1].NomiName != "Alice" || events[1].Message.Text != "Reply from a11ce000-0000-4000-8000-000000000000" {
+		t.Errorf("Unexpected event payloads: %+v", events)
+	}
+}
+
+func TestFireHookDropsWhenQueueFull(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer webhook.Close()
+
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = &Config{Hooks: []HookConfig{{URL: webhook.URL}}}
+
+	// Start the worker, then stand in for one stuck on a slow hook: nothing
+	// reads the queue
+	fireHook(HookEvent{Event: eventSessionStart, Source: "test"})
+	flushHooks()
+	originalQueue := hookQueue
+	defer func() { hookQueue = originalQueue }()
+	hookQueue = make(chan hookJob)
+
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	fireHook(HookEvent{Event: eventMessageSent, Source: "test"})
+	flushHooks()
+	w.Close()
+	os.Stderr = oldStderr
+
+	out, _ := io.ReadAll(r)
+	if !strings.Contains(string(out), "dropping message.sent event") {
+		t.Errorf("Expected the dropped event to be logged, got %q", out)
+	}
+}
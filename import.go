@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var importNomi string   // Nomi the exported messages were exchanged with
+var importFormat string // Export format: auto, json, csv or text
+var importDryRun bool   // Report what would be imported without saving it
+
+// importFields maps the field names used by exports, lowercased without
+// separators, to the message field they hold
+var importFields = map[string]string{
+	"uuid": "uuid", "id": "uuid", "messageid": "uuid", "messageuuid": "uuid",
+	"text": "text", "message": "text", "content": "text", "body": "text", "messagetext": "text",
+	"sent": "sent", "timestamp": "sent", "time": "sent", "date": "sent", "datetime": "sent", "created": "sent", "createdat": "sent",
+	"speaker": "speaker", "sender": "speaker", "role": "speaker", "from": "speaker", "author": "speaker",
+	"nomiuuid": "nomiUuid", "nomiid": "nomiUuid",
+	"nominame": "nomiName", "nomi": "nomiName",
+}
+
+// importTimeLayouts are the timestamp formats found in exports, tried in order
+var importTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"1/2/2006, 15:04:05",
+	"1/2/2006, 15:04",
+	"1/2/06, 15:04",
+	"1/2/2006, 3:04 PM",
+	"1/2/06, 3:04 PM",
+	"1/2/2006 15:04:05",
+	"1/2/2006 15:04",
+	"2006-01-02",
+}
+
+// userSpeakers are the speaker names exports give to the user
+var userSpeakers = wordSet("user you me human i")
+
+// importRecord is a message read from an export, before normalization
+type importRecord struct {
+	UUID, Text, Sent, Speaker, NomiUUID, NomiName string
+}
+
+// normalizeKey lowercases a field name and drops separators, so that
+// "created_at" and "createdAt" match
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "", " ", "").Replace(key))
+}
+
+// fieldString returns a JSON value as a string; numbers are kept as written
+func fieldString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// recordsFromObject reads the messages of a JSON object or CSV row: an
+// exchange with sentMessage and replyMessage, a message possibly nested
+// under "message", or a conversation holding "messages". The Nomi of a
+// conversation applies to its messages.
+func recordsFromObject(object map[string]interface{}, nomi importRecord) []importRecord {
+	// Conversations and lists of conversations
+	for key, value := range object {
+		switch normalizeKey(key) {
+		case "messages", "conversations", "chats":
+			list, ok := value.([]interface{})
+			if !ok {
+				continue
+			}
+			conversation := nomiOf(object, nomi)
+			var records []importRecord
+			for _, item := range list {
+				if child, ok := item.(map[string]interface{}); ok {
+					records = append(records, recordsFromObject(child, conversation)...)
+				}
+			}
+			return records
+		}
+	}
+
+	// A ChatResponse holds both sides of an exchange
+	sent, hasSent := object["sentMessage"].(map[string]interface{})
+	reply, hasReply := object["replyMessage"].(map[string]interface{})
+	if hasSent || hasReply {
+		nomi = nomiOf(object, nomi)
+		var records []importRecord
+		if hasSent {
+			sent["speaker"] = speakerUser
+			records = append(records, recordsFromObject(sent, nomi)...)
+		}
+		if hasReply {
+			reply["speaker"] = speakerNomi
+			records = append(records, recordsFromObject(reply, nomi)...)
+		}
+		return records
+	}
+
+	record := nomiOf(object, nomi)
+
+	// Archive format: {"nomiUuid", "speaker", "message": {"uuid", "text", "sent"}}
+	if nested, ok := object["message"].(map[string]interface{}); ok {
+		nested["speaker"] = object["speaker"]
+		return recordsFromObject(nested, record)
+	}
+
+	for key, value := range object {
+		switch importFields[normalizeKey(key)] {
+		case "uuid":
+			record.UUID = fieldString(value)
+		case "text":
+			record.Text = fieldString(value)
+		case "sent":
+			record.Sent = fieldString(value)
+		case "speaker":
+			record.Speaker = fieldString(value)
+		}
+	}
+	return []importRecord{record}
+}
+
+// nomiOf returns the Nomi named in an object, or the given one
+func nomiOf(object map[string]interface{}, nomi importRecord) importRecord {
+	result := importRecord{NomiUUID: nomi.NomiUUID, NomiName: nomi.NomiName}
+	for key, value := range object {
+		if nested, ok := value.(map[string]interface{}); ok && normalizeKey(key) == "nomi" {
+			result.NomiUUID = fieldString(nested["uuid"])
+			result.NomiName = fieldString(nested["name"])
+			continue
+		}
+		switch importFields[normalizeKey(key)] {
+		case "nomiUuid":
+			result.NomiUUID = fieldString(value)
+		case "nomiName":
+			result.NomiName = fieldString(value)
+		}
+	}
+	return result
+}
+
+// parseJSONExport reads a JSON document, or JSON Lines with one object per line
+func parseJSONExport(data []byte) ([]importRecord, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var records []importRecord
+	for {
+		var document interface{}
+		if err := decoder.Decode(&document); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, fmt.Errorf("error parsing JSON: %w", err)
+		}
+
+		items, ok := document.([]interface{})
+		if !ok {
+			items = []interface{}{document}
+		}
+		for _, item := range items {
+			if object, ok := item.(map[string]interface{}); ok {
+				records = append(records, recordsFromObject(object, importRecord{})...)
+			}
+		}
+	}
+}
+
+// parseCSVExport reads a CSV file whose header names the message fields
+func parseCSVExport(data []byte) ([]importRecord, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	var records []importRecord
+	for _, row := range rows[1:] {
+		object := map[string]interface{}{}
+		for i, value := range row {
+			if i < len(rows[0]) {
+				object[rows[0][i]] = value
+			}
+		}
+		records = append(records, recordsFromObject(object, importRecord{})...)
+	}
+	return records, nil
+}
+
+// Text transcripts have one "[time] Speaker: text" line per message, with
+// the time optional, bracketed or followed by " - " as in chat app exports.
+var (
+	textLineWithTime = regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2}[ T]\d{1,2}:\d{2}(?::\d{2})?|\d{1,2}/\d{1,2}/\d{2,4},? \d{1,2}:\d{2}(?::\d{2})?(?: ?[AP]M)?)\]?(?: -)? ([^:]{1,64}): ?(.*)$`)
+	textLine         = regexp.MustCompile(`^([^:]{1,64}): (.*)$`)
+)
+
+// parseTextExport reads a plain text transcript. Lines that don't start a
+// message continue the previous one. Without a time, a line only starts a
+// message when its speaker is the user or the Nomi, so that colons in the
+// text aren't mistaken for speakers.
+func parseTextExport(data []byte, nomiName string) []importRecord {
+	var records []importRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if m := textLineWithTime.FindStringSubmatch(line); m != nil {
+			records = append(records, importRecord{Sent: m[1], Speaker: strings.TrimSpace(m[2]), Text: m[3]})
+			continue
+		}
+		if m := textLine.FindStringSubmatch(line); m != nil {
+			speaker := strings.TrimSpace(m[1])
+			if userSpeakers[strings.ToLower(speaker)] || strings.EqualFold(speaker, nomiName) {
+				records = append(records, importRecord{Speaker: speaker, Text: m[2]})
+				continue
+			}
+		}
+		if len(records) > 0 {
+			records[len(records)-1].Text += "\n" + line
+		}
+	}
+	for i := range records {
+		records[i].Text = strings.TrimSpace(records[i].Text)
+	}
+	return records
+}
+
+// parseImportTime normalizes an export timestamp to the API's RFC 3339
+// format, reading times without a zone as local. Numbers are Unix times in
+// seconds or milliseconds. Unknown formats give an empty time.
+func parseImportTime(value string) string {
+	value = strings.TrimSpace(value)
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if n > 1e11 {
+			return time.UnixMilli(n).UTC().Format(time.RFC3339Nano)
+		}
+		return time.Unix(n, 0).UTC().Format(time.RFC3339Nano)
+	}
+	for _, layout := range importTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return ""
+}
+
+// needsNomis reports whether resolving the Nomis of records takes the API:
+// some name their Nomi without its UUID
+func needsNomis(records []importRecord) bool {
+	for _, r := range records {
+		if r.NomiUUID == "" && r.NomiName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveImportNomis fills in the UUID of records naming their Nomi
+// without one, and returns the names matching no Nomi
+func resolveImportNomis(records []importRecord, nomis []Nomi) (unknown []string) {
+	seen := map[string]bool{}
+	for i, r := range records {
+		if r.NomiUUID != "" || r.NomiName == "" {
+			continue
+		}
+		if nomi, ok := findNomi(nomis, r.NomiName); ok {
+			records[i].NomiUUID, records[i].NomiName = nomi.UUID, nomi.Name
+		} else if !seen[strings.ToLower(r.NomiName)] {
+			seen[strings.ToLower(r.NomiName)] = true
+			unknown = append(unknown, r.NomiName)
+		}
+	}
+	return unknown
+}
+
+// normalizeImport turns export records into archived messages, filling in
+// the Nomi of records naming none and deriving a stable UUID for messages
+// without one, so that importing the same export twice finds the same
+// messages. Records without text or a Nomi UUID are skipped.
+func normalizeImport(records []importRecord, nomi Nomi) (messages []archivedMessage, skipped int) {
+	for _, r := range records {
+		if r.NomiUUID == "" && r.NomiName == "" {
+			r.NomiUUID, r.NomiName = nomi.UUID, nomi.Name
+		}
+		if r.NomiName == "" {
+			r.NomiName = nomi.Name
+		}
+		if strings.TrimSpace(r.Text) == "" || r.NomiUUID == "" {
+			skipped++
+			continue
+		}
+
+		speaker := speakerNomi
+		if role := strings.ToLower(strings.TrimSpace(r.Speaker)); userSpeakers[role] {
+			speaker = speakerUser
+		}
+		sent := parseImportTime(r.Sent)
+		uuid := r.UUID
+		if uuid == "" {
+			sum := sha256.Sum256([]byte(strings.Join([]string{r.NomiUUID, speaker, sent, r.Text}, "\x00")))
+			uuid = "import-" + hex.EncodeToString(sum[:12])
+		}
+
+		messages = append(messages, archivedMessage{
+			NomiUUID: r.NomiUUID,
+			NomiName: r.NomiName,
+			Speaker:  speaker,
+			Message:  Message{UUID: uuid, Text: r.Text, Sent: sent},
+		})
+	}
+	return messages, skipped
+}
+
+// importMessages adds messages to the archive, skipping those whose UUID
+// is already there, and returns how many were added per Nomi UUID
+func importMessages(s *secureStore, messages []archivedMessage, dryRun bool) (map[string]int, error) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+
+	added := map[string]int{}
+	seen := map[string]map[string]bool{}
+	for _, message := range messages {
+		name := archivePrefix + message.NomiUUID
+		if seen[name] == nil {
+			seen[name] = map[string]bool{}
+			records, err := s.readRecords(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				var existing archivedMessage
+				if json.Unmarshal(record, &existing) == nil {
+					seen[name][existing.Message.UUID] = true
+				}
+			}
+		}
+		if seen[name][message.Message.UUID] {
+			continue
+		}
+		seen[name][message.Message.UUID] = true
+		added[message.NomiUUID]++
+		if dryRun {
+			continue
+		}
+
+		data, err := json.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.appendRecord(name, data); err != nil {
+			return nil, err
+		}
+	}
+	return added, nil
+}
+
+// readExport reads an export file in the given or detected format
+func readExport(path, format, nomiName string) ([]importRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "auto" {
+		switch ext := strings.ToLower(filepath.Ext(path)); {
+		case ext == ".json" || ext == ".jsonl" || ext == ".ndjson":
+			format = "json"
+		case ext == ".csv":
+			format = "csv"
+		case bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) || bytes.HasPrefix(bytes.TrimSpace(data), []byte("[{")):
+			format = "json"
+		default:
+			format = "text"
+		}
+	}
+
+	switch format {
+	case "json":
+		return parseJSONExport(data)
+	case "csv":
+		return parseCSVExport(data)
+	case "text":
+		return parseTextExport(data, nomiName), nil
+	}
+	return nil, fmt.Errorf("unknown format %q: use auto, json, csv or text", format)
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>...",
+	Short: "Import conversations exported from the Nomi app or other tools",
+	Long: `Import exported conversations into the local archive, where search, stats
+and history can use them. JSON (including JSON Lines and this CLI's own
+exports), CSV with a header row and plain text transcripts are supported.
+Messages already imported are skipped, so an export can be imported again
+after it grew.`,
+	Args:        cobra.MinimumNArgs(1),
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		// The API is only needed to look Nomis up, so fetch them on first use
+		var nomis []Nomi
+		getNomis := func() ([]Nomi, error) {
+			if nomis != nil {
+				return nomis, nil
+			}
+			if client == nil {
+				if err := setupClient(); err != nil {
+					return nil, err
+				}
+			}
+			var err error
+			nomis, err = client.GetNomis()
+			return nomis, err
+		}
+
+		// The Nomi of messages whose export doesn't name one
+		var nomi Nomi
+		if importNomi != "" {
+			known, err := getNomis()
+			if err != nil {
+				fmt.Println("Error fetching Nomis:", err)
+				return
+			}
+			found, ok := findNomi(known, importNomi)
+			if !ok {
+				fmt.Printf("No Nomi named %s\n", importNomi)
+				return
+			}
+			nomi = found
+		}
+
+		var messages []archivedMessage
+		skipped := 0
+		for _, path := range args {
+			records, err := readExport(path, importFormat, nomi.Name)
+			if err != nil {
+				fmt.Printf("Error reading %s: %v\n", path, err)
+				return
+			}
+			if needsNomis(records) {
+				known, err := getNomis()
+				if err != nil {
+					fmt.Println("Error fetching Nomis:", err)
+					return
+				}
+				for _, name := range resolveImportNomis(records, known) {
+					fmt.Printf("No Nomi named %s in %s, skipping its messages\n", name, path)
+				}
+			}
+			normalized, n := normalizeImport(records, nomi)
+			messages = append(messages, normalized...)
+			skipped += n
+		}
+		if skipped > 0 && nomi.UUID == "" {
+			fmt.Printf("Skipped %d %s without text or a Nomi; use --nomi to name the Nomi of the export\n", skipped, plural(skipped, "entry", "entries"))
+		} else if skipped > 0 {
+			fmt.Printf("Skipped %d %s without text\n", skipped, plural(skipped, "entry", "entries"))
+		}
+		if len(messages) == 0 {
+			fmt.Println("No messages to import")
+			return
+		}
+
+		s, err := openStore()
+		if err != nil {
+			fmt.Println("Error opening message archive:", err)
+			return
+		}
+		added, err := importMessages(s, messages, importDryRun)
+		if err != nil {
+			fmt.Println("Error importing messages:", err)
+			return
+		}
+
+		// Report per Nomi, by name
+		names := map[string]string{}
+		total := map[string]int{}
+		for _, message := range messages {
+			names[message.NomiUUID] = message.NomiName
+			total[message.NomiUUID]++
+		}
+		uuids := make([]string, 0, len(names))
+		for uuid := range names {
+			uuids = append(uuids, uuid)
+		}
+		sort.Slice(uuids, func(i, j int) bool { return names[uuids[i]] < names[uuids[j]] })
+
+		verb := "Imported"
+		if importDryRun {
+			verb = "Would import"
+		}
+		for _, uuid := range uuids {
+			fmt.Printf("%s %d %s with %s (%d already imported)\n", verb, added[uuid], plural(added[uuid], "message", "messages"), names[uuid], total[uuid]-added[uuid])
+		}
+	},
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importNomi, "nomi", "", "Nomi (name or UUID) of messages whose export doesn't name one")
+	importCmd.Flags().StringVar(&importFormat, "format", "auto", "Export format: auto, json, csv or text")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Show what would be imported without saving it")
+}
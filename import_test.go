@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSONExport(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"chat responses", `[{"sentMessage": {"uuid": "m1", "text": "Hi", "sent": "2026-10-01T10:00:00Z"},
+			"replyMessage": {"uuid": "m2", "text": "Hello!", "sent": "2026-10-01T10:00:03Z"}}]`},
+		{"conversation", `{"nomi": {"uuid": "uuid-alice", "name": "Alice"}, "messages": [
+			{"id": "m1", "sender": "user", "content": "Hi", "created_at": "2026-10-01T10:00:00Z"},
+			{"id": "m2", "sender": "Alice", "content": "Hello!", "created_at": "2026-10-01T10:00:03Z"}]}`},
+		{"archive lines", `{"nomiUuid": "uuid-alice", "nomiName": "Alice", "speaker": "user", "message": {"uuid": "m1", "text": "Hi", "sent": "2026-10-01T10:00:00Z"}}
+			{"nomiUuid": "uuid-alice", "nomiName": "Alice", "speaker": "nomi", "message": {"uuid": "m2", "text": "Hello!", "sent": "2026-10-01T10:00:03Z"}}`},
+	}
+
+	for _, test := range tests {
+		records, err := parseJSONExport([]byte(test.data))
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", test.name, err)
+		}
+		messages, skipped := normalizeImport(records, Nomi{UUID: "uuid-alice", Name: "Alice"})
+		if skipped != 0 || len(messages) != 2 {
+			t.Fatalf("%s: expected 2 messages, got %+v (%d skipped)", test.name, messages, skipped)
+		}
+		if messages[0].Speaker != speakerUser || messages[0].Message != (Message{UUID: "m1", Text: "Hi", Sent: "2026-10-01T10:00:00Z"}) {
+			t.Errorf("%s: unexpected first message %+v", test.name, messages[0])
+		}
+		if messages[1].Speaker != speakerNomi || messages[1].NomiUUID != "uuid-alice" || messages[1].NomiName != "Alice" {
+			t.Errorf("%s: unexpected reply %+v", test.name, messages[1])
+		}
+	}
+
+	if _, err := parseJSONExport([]byte(`[{"text": `)); err == nil {
+		t.Error("Expected invalid JSON to be rejected")
+	}
+}
+
+func TestParseCSVExport(t *testing.T) {
+	data := "Timestamp,Role,Message\n1759312800,You,\"Hi, Alice\"\n1759312803000,Alice,Hello!\n,,\n"
+	records, err := parseCSVExport([]byte(data))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	messages, skipped := normalizeImport(records, Nomi{UUID: "uuid-alice", Name: "Alice"})
+	if skipped != 1 || len(messages) != 2 {
+		t.Fatalf("Expected 2 messages and a skipped row, got %+v (%d skipped)", messages, skipped)
+	}
+	if messages[0].Message.Text != "Hi, Alice" || messages[0].Message.Sent != "2025-10-01T10:00:00Z" || messages[0].Speaker != speakerUser {
+		t.Errorf("Unexpected first message %+v", messages[0])
+	}
+	if messages[1].Message.Sent != "2025-10-01T10:00:03Z" || messages[1].Speaker != speakerNomi {
+		t.Errorf("Expected a timestamp in milliseconds, got %+v", messages[1])
+	}
+}
+
+func TestParseTextExport(t *testing.T) {
+	oldLocal := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = oldLocal }()
+
+	data := `[2026-10-01 10:00] You: Packing list:
+- sunscreen
+- hat
+10/1/26, 10:01 AM - Alice: Don't forget the camera
+Note: this line continues Alice's message
+You: Good idea
+Alice: Always!`
+	messages, _ := normalizeImport(parseTextExport([]byte(data), "Alice"), Nomi{UUID: "uuid-alice", Name: "Alice"})
+
+	if len(messages) != 4 {
+		t.Fatalf("Expected 4 messages, got %+v", messages)
+	}
+	if messages[0].Message.Text != "Packing list:\n- sunscreen\n- hat" || messages[0].Message.Sent != "2026-10-01T10:00:00Z" {
+		t.Errorf("Expected a multi-line message, got %+v", messages[0])
+	}
+	if messages[1].Speaker != speakerNomi || messages[1].Message.Sent != "2026-10-01T10:01:00Z" || !strings.HasSuffix(messages[1].Message.Text, "continues Alice's message") {
+		t.Errorf("Unexpected chat app line %+v", messages[1])
+	}
+	if messages[2].Speaker != speakerUser || messages[3].Message.Text != "Always!" || messages[3].Message.Sent != "" {
+		t.Errorf("Unexpected lines without time %+v", messages[2:])
+	}
+
+	// Messages without a UUID get the same one on every import
+	again, _ := normalizeImport(parseTextExport([]byte(data), "Alice"), Nomi{UUID: "uuid-alice", Name: "Alice"})
+	if !strings.HasPrefix(messages[0].Message.UUID, "import-") || again[0].Message.UUID != messages[0].Message.UUID || messages[2].Message.UUID == messages[3].Message.UUID {
+		t.Errorf("Expected stable, distinct UUIDs, got %q %q", messages[0].Message.UUID, again[0].Message.UUID)
+	}
+}
+
+func TestImportCommand(t *testing.T) {
+	setupArchiveTest(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(NomiResponse{Nomis: []Nomi{{UUID: "uuid-alice", Name: "Alice"}}})
+	}))
+	defer server.Close()
+	client = NewNomiClient("test-api-key", server.URL)
+
+	path := filepath.Join(t.TempDir(), "alice.txt")
+	os.WriteFile(path, []byte("[2026-10-01 10:00] You: Hi\n[2026-10-01 10:01] Alice: Hello!\n"), 0600)
+
+	if output := runCommand(t, importCmd, "", path); !strings.Contains(output, "Skipped 2 entries without text or a Nomi; use --nomi") {
+		t.Errorf("Expected the Nomi to be required, got %q", output)
+	}
+	if output := runCommand(t, importCmd, "", path, "--nomi", "alice", "--dry-run"); !strings.Contains(output, "Would import 2 messages with Alice (0 already imported)") {
+		t.Errorf("Expected a dry run, got %q", output)
+	}
+	if archiveExists() {
+		t.Error("Expected a dry run to save nothing")
+	}
+	if output := runCommand(t, importCmd, "", path, "--nomi", "alice"); !strings.Contains(output, "Imported 2 messages with Alice (0 already imported)") {
+		t.Errorf("Expected 2 messages to be imported, got %q", output)
+	}
+
+	// Importing a longer export again only adds the new messages
+	os.WriteFile(path, []byte("[2026-10-01 10:00] You: Hi\n[2026-10-01 10:01] Alice: Hello!\n[2026-10-01 10:02] You: Bye\n"), 0600)
+	if output := runCommand(t, importCmd, "", path, "--nomi", "uuid-alice"); !strings.Contains(output, "Imported 1 message with Alice (2 already imported)") {
+		t.Errorf("Expected duplicates to be skipped, got %q", output)
+	}
+	messages, _ := loadArchive(store)
+	if len(messages) != 3 {
+		t.Errorf("Expected 3 archived messages, got %d", len(messages))
+	}
+
+	if output := runCommand(t, importCmd, "", path, "--nomi", "Carol"); !strings.Contains(output, "No Nomi named Carol") {
+		t.Errorf("Expected an unknown Nomi error, got %q", output)
+	}
+	if output := runCommand(t, importCmd, "", path, "--format", "xml"); !strings.Contains(output, `unknown format "xml"`) {
+		t.Errorf("Expected an unknown format error, got %q", output)
+	}
+}
+
+func TestImportCommandResolvesNomiNames(t *testing.T) {
+	setupArchiveTest(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(NomiResponse{Nomis: []Nomi{{UUID: "uuid-alice", Name: "Alice"}}})
+	}))
+	defer server.Close()
+	oldClient := client
+	defer func() { client = oldClient }()
+
+	// Records carrying their Nomi's UUID need no API key
+	client = nil
+	path := filepath.Join(t.TempDir(), "export.csv")
+	os.WriteFile(path, []byte("nomiUuid,nomiName,sender,text,timestamp\nuuid-alice,Alice,user,Hi,2026-10-01T10:00:00Z\n"), 0600)
+	if output := runCommand(t, importCmd, "", path); !strings.Contains(output, "Imported 1 message with Alice (0 already imported)") {
+		t.Errorf("Expected an import without the API, got %q", output)
+	}
+
+	// Records naming their Nomi are resolved through the API, once
+	client = NewNomiClient("test-api-key", server.URL)
+	os.WriteFile(path, []byte("nomi,sender,text,timestamp\nalice,user,Hello,2026-10-01T10:01:00Z\nalice,Alice,Hi!,2026-10-01T10:02:00Z\nCarol,user,Hey,2026-10-01T10:03:00Z\n"), 0600)
+	output := runCommand(t, importCmd, "", path)
+	if !strings.Contains(output, "Imported 2 messages with Alice (0 already imported)") || !strings.Contains(output, "No Nomi named Carol in "+path) {
+		t.Errorf("Expected Alice to be resolved and Carol skipped, got %q", output)
+	}
+	if requests != 1 {
+		t.Errorf("Expected Nomis to be fetched once, got %d requests", requests)
+	}
+}
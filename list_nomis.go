@@ -17,6 +17,12 @@ var listNomisCmd = &cobra.Command{
 			fmt.Println("Error fetching Nomis:", err)
 			return
 		}
+		query, err := parseListQuery[Nomi](listFilters, listSort, listLimit)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		nomis = applyListQuery(nomis, query)
 
 		// Display the Nomis
 		for _, nomi := range nomis {
@@ -35,4 +41,5 @@ var listNomisCmd = &cobra.Command{
 func init() {
 	// Add the --full flag to the list-nomis command
 	listNomisCmd.Flags().BoolVarP(&fullOutput, "full", "f", false, "Display full details of each Nomi")
+	addListQueryFlags(listNomisCmd, "relationshipType=Mentor")
 }
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var listFilters []string // Filter expressions, all of which must match
+var listSort string      // Fields to sort by, e.g. "created:desc,name"
+var listLimit int        // Maximum number of items shown, 0 for all
+
+// listItem is something list commands can filter and sort: it exposes its
+// fields by lowercase name, each with one or more values
+type listItem interface {
+	listFields() map[string][]string
+}
+
+func (n Nomi) listFields() map[string][]string {
+	return map[string][]string{
+		"uuid":             {n.UUID},
+		"name":             {n.Name},
+		"gender":           {n.Gender},
+		"created":          {n.Created},
+		"relationshiptype": {n.RelationshipType},
+	}
+}
+
+func (r Room) listFields() map[string][]string {
+	return map[string][]string{
+		"uuid":           {r.UUID},
+		"name":           {r.Name},
+		"created":        {r.Created},
+		"updated":        {r.Updated},
+		"status":         {r.Status},
+		"backchanneling": {strconv.FormatBool(r.BackchannelingEnabled)},
+		"note":           {r.Note},
+		"member":         memberNames(r),
+		"members":        {strconv.Itoa(len(r.Nomis))},
+	}
+}
+
+// listOperators are the filter operators, two-character ones first so that
+// ">=" isn't read as ">"
+var listOperators = []string{"!=", ">=", "<=", "!~", "=", "~", ">", "<"}
+
+// listFilter is a parsed --filter expression such as "name~^A"
+type listFilter struct {
+	field    string
+	operator string
+	value    string
+	pattern  *regexp.Regexp // For ~ and !~
+}
+
+// listSortKey is a parsed --sort field such as "created:desc"
+type listSortKey struct {
+	field      string
+	descending bool
+}
+
+// listQuery is what --filter, --sort and --limit ask of a list command
+type listQuery struct {
+	filters []listFilter
+	sorts   []listSortKey
+	limit   int
+}
+
+// parseListQuery checks the filter and sort expressions against the fields
+// of the zero item, so typos are reported rather than matching nothing
+func parseListQuery[T listItem](filters []string, sortBy string, limit int) (listQuery, error) {
+	var zero T
+	fields := zero.listFields()
+	checkField := func(name string) (string, error) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := fields[name]; !ok {
+			return "", fmt.Errorf("unknown field %q, expected one of %s", name, strings.Join(sortedKeys(fields), ", "))
+		}
+		return name, nil
+	}
+
+	query := listQuery{limit: limit}
+	if limit < 0 {
+		return query, fmt.Errorf("--limit must not be negative")
+	}
+	for _, expr := range filters {
+		index, operator := -1, ""
+		for _, op := range listOperators {
+			if i := strings.Index(expr, op); i > 0 && (index == -1 || i < index || (i == index && len(op) > len(operator))) {
+				index, operator = i, op
+			}
+		}
+		if index == -1 {
+			return query, fmt.Errorf("invalid filter %q, expected a field, an operator (%s) and a value", expr, strings.Join(listOperators, " "))
+		}
+
+		field, err := checkField(expr[:index])
+		if err != nil {
+			return query, err
+		}
+		filter := listFilter{field: field, operator: operator, value: strings.TrimSpace(expr[index+len(operator):])}
+		if operator == "~" || operator == "!~" {
+			// Matches are case-insensitive, as equality is
+			if filter.pattern, err = regexp.Compile("(?i)" + filter.value); err != nil {
+				return query, fmt.Errorf("invalid pattern in filter %q: %w", expr, err)
+			}
+		}
+		query.filters = append(query.filters, filter)
+	}
+
+	if sortBy != "" {
+		for _, key := range strings.Split(sortBy, ",") {
+			name, direction, _ := strings.Cut(key, ":")
+			field, err := checkField(name)
+			if err != nil {
+				return query, err
+			}
+			switch strings.ToLower(direction) {
+			case "", "asc":
+				query.sorts = append(query.sorts, listSortKey{field: field})
+			case "desc":
+				query.sorts = append(query.sorts, listSortKey{field: field, descending: true})
+			default:
+				return query, fmt.Errorf("invalid sort direction %q for %s, expected asc or desc", direction, field)
+			}
+		}
+	}
+	return query, nil
+}
+
+// parseListTime reads API timestamps and dates given in filters. The
+// boolean reports a date without a time of day.
+func parseListTime(value string) (time.Time, bool, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, false, true
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, true
+	}
+	return time.Time{}, false, false
+}
+
+// compareListValues orders two field values as times, numbers or
+// case-insensitive text, whichever both values are. A date compared with a
+// timestamp only considers the timestamp's day, so created=2024-01-01
+// matches anything created that day.
+func compareListValues(a, b string) int {
+	if ta, _, ok := parseListTime(a); ok {
+		if tb, dateOnly, ok := parseListTime(b); ok {
+			if dateOnly {
+				ta = time.Date(ta.UTC().Year(), ta.UTC().Month(), ta.UTC().Day(), 0, 0, 0, 0, time.UTC)
+			}
+			return ta.Compare(tb)
+		}
+	}
+	if na, err := strconv.ParseFloat(a, 64); err == nil {
+		if nb, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case na < nb:
+				return -1
+			case na > nb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// matches reports whether any value of the field passes the filter, or
+// for != and !~, whether none equals or matches the value
+func (f listFilter) matches(fields map[string][]string) bool {
+	negated := f.operator == "!=" || f.operator == "!~"
+	for _, value := range fields[f.field] {
+		var ok bool
+		switch f.operator {
+		case "~", "!~":
+			ok = f.pattern.MatchString(value)
+		case "=", "!=":
+			ok = compareListValues(value, f.value) == 0
+		case ">":
+			ok = compareListValues(value, f.value) > 0
+		case ">=":
+			ok = compareListValues(value, f.value) >= 0
+		case "<":
+			ok = compareListValues(value, f.value) < 0
+		case "<=":
+			ok = compareListValues(value, f.value) <= 0
+		}
+		if ok {
+			return !negated
+		}
+	}
+	return negated
+}
+
+// applyListQuery filters, sorts and limits items. Items comparing equal
+// keep the API's order.
+func applyListQuery[T listItem](items []T, query listQuery) []T {
+	var result []T
+	for _, item := range items {
+		fields := item.listFields()
+		keep := true
+		for _, filter := range query.filters {
+			if !filter.matches(fields) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result = append(result, item)
+		}
+	}
+
+	if len(query.sorts) > 0 {
+		sort.SliceStable(result, func(i, j int) bool {
+			a, b := result[i].listFields(), result[j].listFields()
+			for _, key := range query.sorts {
+				c := compareListValues(strings.Join(a[key.field], ", "), strings.Join(b[key.field], ", "))
+				if key.descending {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+
+	if query.limit > 0 && len(result) > query.limit {
+		result = result[:query.limit]
+	}
+	return result
+}
+
+// addListQueryFlags adds --filter, --sort and --limit to a list command
+func addListQueryFlags(cmd *cobra.Command, example string) {
+	cmd.Flags().StringArrayVar(&listFilters, "filter", nil, "Only list items matching field=value, with = != ~ !~ > >= < <= (repeatable, e.g. "+example+")")
+	cmd.Flags().StringVar(&listSort, "sort", "", "Sort by fields, each optionally followed by :asc or :desc (e.g. created:desc,name)")
+	cmd.Flags().IntVar(&listLimit, "limit", 0, "Show at most this many items, 0 for all")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyListQueryNomis(t *testing.T) {
+	nomis := []Nomi{
+		{UUID: "1", Name: "John", Created: "2023-06-01T12:00:00Z", RelationshipType: "Friend"},
+		{UUID: "2", Name: "Alice", Created: "2024-01-01T08:30:00Z", RelationshipType: "Mentor"},
+		{UUID: "3", Name: "Anna", Created: "2024-03-15T09:00:00Z", RelationshipType: "Mentor"},
+		{UUID: "4", Name: "Bob", Created: "2024-02-01T10:00:00Z", RelationshipType: "Friend"},
+	}
+
+	tests := []struct {
+		name     string
+		filters  []string
+		sort     string
+		limit    int
+		expected string
+	}{
+		{"No query keeps API order", nil, "", 0, "John Alice Anna Bob"},
+		{"Equality ignores case", []string{"relationshipType=mentor"}, "", 0, "Alice Anna"},
+		{"Inequality", []string{"relationshiptype!=Mentor"}, "", 0, "John Bob"},
+		{"Pattern", []string{"name~^A"}, "", 0, "Alice Anna"},
+		{"Negated pattern", []string{"name!~^a"}, "", 0, "John Bob"},
+		{"Date comparison", []string{"created>2024-01-01"}, "", 0, "Anna Bob"},
+		{"Date equality matches the whole day", []string{"created=2024-01-01"}, "", 0, "Alice"},
+		{"Filters are combined", []string{"created>=2024-01-01", "name~^A"}, "", 0, "Alice Anna"},
+		{"Sort by name", nil, "name", 0, "Alice Anna Bob John"},
+		{"Sort by date descending", nil, "created:desc", 0, "Anna Bob Alice John"},
+		{"Sort by several fields", nil, "relationshipType,name:desc", 0, "John Bob Anna Alice"},
+		{"Limit", nil, "created:desc", 2, "Anna Bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := parseListQuery[Nomi](tt.filters, tt.sort, tt.limit)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var names []string
+			for _, nomi := range applyListQuery(nomis, query) {
+				names = append(names, nomi.Name)
+			}
+			if got := strings.Join(names, " "); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestApplyListQueryRooms(t *testing.T) {
+	alice := Nomi{Name: "Alice"}
+	bob := Nomi{Name: "Bob"}
+	rooms := []Room{
+		{Name: "Book Club", Status: "Ready", Nomis: []Nomi{alice, bob}},
+		{Name: "Chess", Status: "Waiting", Nomis: []Nomi{bob}},
+		{Name: "Garden", Status: "Ready", Nomis: []Nomi{alice}},
+	}
+
+	tests := []struct {
+		filters  []string
+		sort     string
+		expected string
+	}{
+		{[]string{"status=Ready"}, "", "Book Club,Garden"},
+		{[]string{"member=Alice"}, "", "Book Club,Garden"},
+		{[]string{"member!=Alice"}, "", "Chess"},
+		{[]string{"members>1"}, "", "Book Club"},
+		{nil, "members:desc,name", "Book Club,Chess,Garden"},
+		{nil, "status:desc", "Chess,Book Club,Garden"},
+	}
+	for _, tt := range tests {
+		query, err := parseListQuery[Room](tt.filters, tt.sort, 0)
+		if err != nil {
+			t.Fatalf("Expected no error for %v, got %v", tt.filters, err)
+		}
+		var names []string
+		for _, room := range applyListQuery(rooms, query) {
+			names = append(names, room.Name)
+		}
+		if got := strings.Join(names, ","); got != tt.expected {
+			t.Errorf("Expected %q for %v sorted by %q, got %q", tt.expected, tt.filters, tt.sort, got)
+		}
+	}
+}
+
+func TestParseListQueryErrors(t *testing.T) {
+	tests := []struct {
+		filters []string
+		sort    string
+		limit   int
+		err     string
+	}{
+		{[]string{"colour=red"}, "", 0, `unknown field "colour"`},
+		{[]string{"name"}, "", 0, "invalid filter"},
+		{[]string{"=Alice"}, "", 0, "invalid filter"},
+		{[]string{"name~("}, "", 0, "invalid pattern"},
+		{nil, "name:up", 0, "invalid sort direction"},
+		{nil, "member", 0, `unknown field "member"`}, // Rooms only
+		{nil, "", -1, "--limit"},
+	}
+	for _, tt := range tests {
+		_, err := parseListQuery[Nomi](tt.filters, tt.sort, tt.limit)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected an error containing %q for %v %q, got %v", tt.err, tt.filters, tt.sort, err)
+		}
+	}
+}
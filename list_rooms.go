@@ -12,7 +12,7 @@ func displayRoom(room Room) {
 		name = "<empty>"
 	}
 
-	fmt.Printf("Room: %s\n", name)
+	fmt.Printf("Room: %s\n", theme.Title.Render(name))
 	fmt.Printf("- UUID: %s\n", room.UUID)
 	fmt.Printf("- Created: %s\n", room.Created)
 	fmt.Printf("- Updated: %s\n", room.Updated)
@@ -27,9 +27,9 @@ func displayRoom(room Room) {
 		fmt.Println("- Nomis:")
 		for _, nomi := range room.Nomis {
 			fmt.Printf("  • %s (%s, %s)\n",
-				nomi.Name,
+				theme.Nomi.Render(nomi.Name),
 				nomi.Gender,
-				nomi.RelationshipType)
+				theme.Accent.Render(nomi.RelationshipType))
 		}
 	}
 }
@@ -44,6 +44,12 @@ var listRoomsCmd = &cobra.Command{
 			fmt.Println("Error fetching rooms:", err)
 			return
 		}
+		query, err := parseListQuery[Room](listFilters, listSort, listLimit)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		rooms = applyListQuery(rooms, query)
 
 		// Print the Rooms
 		fmt.Printf("Total Rooms: %d\n\n", len(rooms))
@@ -53,3 +59,7 @@ var listRoomsCmd = &cobra.Command{
 		}
 	},
 }
+
+func init() {
+	addListQueryFlags(listRoomsCmd, "member=Alice")
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -10,6 +14,67 @@ import (
 var apiKey string      // Store the API key globally
 var baseURL string     // Store the base API URL globally
 var client *NomiClient // Global API client
+var verbose bool       // Log each HTTP request to stderr or the log file
+var debug bool         // Also log HTTP headers and bodies
+var logFile string     // Write HTTP traces to this file instead of stderr
+
+// shutdownTelemetry flushes exported traces and metrics before exiting
+var shutdownTelemetry = func(context.Context) error { return nil }
+
+// finish delivers queued hook events and flushes telemetry before exiting
+func finish() {
+	flushHooks()
+
+	// Flush telemetry, without hanging on an unreachable collector
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTelemetry(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "Error exporting telemetry:", err)
+	}
+}
+
+// exit finishes up and exits with the given status, as os.Exit skips
+// PersistentPostRun
+func exit(code int) {
+	finish()
+	os.Exit(code)
+}
+
+// setupClient finds the API key and creates the API client, tracing its
+// requests if asked to. Commands whose key is optional call it themselves
+// once they know they need the API.
+func setupClient() error {
+	// Find the API key from flags, environment, config or the stored key
+	key, _, err := resolveAPIKey()
+	if err != nil {
+		return err
+	}
+	apiKey = key
+
+	// Ensure an API key is available
+	if apiKey == "" {
+		return fmt.Errorf("API key not found. Please set the NOMI_API_KEY environment variable, use the -k flag or run 'nomi-cli auth login'")
+	}
+
+	// Initialize the API client
+	client = NewNomiClient(apiKey, baseURL)
+
+	// Trace HTTP requests if asked to
+	if verbose || debug {
+		var out io.Writer = os.Stderr
+		if logFile != "" {
+			f, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				return fmt.Errorf("error opening log file: %w", err)
+			}
+			out = f
+		}
+		transport := newTracingTransport(http.DefaultTransport, out, debug, apiKey)
+		transport.redactMessages = logFile != ""
+		client.httpClient.Transport = transport
+	}
+	return nil
+}
 
 func main() {
 	var rootCmd = &cobra.Command{
@@ -17,47 +82,69 @@ func main() {
 		Short: "A CLI client for the Nomi.ai API",
 		Long:  `nomi-cli is a command-line client to interact with the Nomi.ai API`,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			// Load the API key from the environment variable if not provided as a flag
-			if apiKey == "" {
-				apiKey = os.Getenv("NOMI_API_KEY")
+			// Load the configuration file
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			config = cfg
+			if config.Accessible {
+				accessible = true
 			}
 
-			// Ensure an API key is available
-			if apiKey == "" {
-				return fmt.Errorf("API key not found. Please set the NOMI_API_KEY environment variable or use the -k flag")
+			// Refuse to run with credentials or messages readable by others
+			if err := checkPermissions(os.Stderr); err != nil {
+				return err
 			}
+
+			// Pick the output theme and whether to use colors at all
+			t, err := newTheme(config.Theme, colorMode)
+			if err != nil {
+				return err
+			}
+			theme = t
+
+			// Export traces and metrics if enabled in the config
+			shutdown, err := setupTelemetry(config.Telemetry)
+			if err != nil {
+				return err
+			}
+			shutdownTelemetry = shutdown
+
 			// Load the base API URL from the environment variable
 			baseURL = os.Getenv("NOMI_API_URL")
 			if baseURL == "" {
 				baseURL = "https://api.nomi.ai/v1" // Default value if environment variable is not set
 			}
 
-			// Initialize the API client
-			client = NewNomiClient(apiKey, baseURL)
-			return nil
+			// Commands managing the stored key don't need one to run
+			if cmd.Annotations["apiKey"] == "optional" {
+				return nil
+			}
+
+			return setupClient()
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			finish()
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			// Start a spinner while fetching Nomis
-			stopChan := make(chan bool)
-			go spinner(stopChan)
+			// Show progress while fetching Nomis
+			done := waitFor("Loading Nomis…", "Nomis loaded")
 
 			// Get the list of Nomis
 			nomis, err := client.GetNomis()
-
-			// Stop the spinner
-			close(stopChan)
-			fmt.Print("\r") // Clear the spinner line
+			done()
 
 			if err != nil {
 				fmt.Println("Error fetching Nomis:", err)
-				os.Exit(1)
+				exit(1)
 			}
 
 			// Display the selectable menu
 			selectedNomi, err := selectableMenu(nomis)
 			if err != nil {
 				fmt.Println(err)
-				os.Exit(1)
+				exit(1)
 			}
 
 			// Start chat with the selected Nomi
@@ -67,6 +154,13 @@ func main() {
 
 	// Allow overriding the API key via a flag
 	rootCmd.PersistentFlags().StringVarP(&apiKey, "api-key", "k", "", "API key for Nomi.ai (overrides NOMI_API_KEY)")
+	rootCmd.PersistentFlags().StringVar(&apiKeyFile, "api-key-file", "", "Read the API key from a file (overrides NOMI_API_KEY)")
+	rootCmd.PersistentFlags().BoolVar(&apiKeyStdin, "api-key-stdin", false, "Read the API key from the first line of stdin (overrides NOMI_API_KEY)")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Log HTTP requests, status codes and durations")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Log HTTP requests including headers and bodies (secrets are redacted)")
+	rootCmd.PersistentFlags().BoolVar(&accessible, "accessible", false, "Screen-reader friendly output: no spinner or screen clearing, labeled messages, numbered menus")
+	rootCmd.PersistentFlags().StringVar(&colorMode, "color", "auto", "Colorize output: auto, always or never (auto honors NO_COLOR)")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Write HTTP logs to a file instead of stderr")
 
 	// Add commands
 	rootCmd.AddCommand(listNomisCmd)
@@ -74,6 +168,20 @@ func main() {
 	rootCmd.AddCommand(chatCmd)
 	rootCmd.AddCommand(listRoomsCmd)
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(mcpCmd)
+	rootCmd.AddCommand(scheduleCmd)
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(authCmd)
+	rootCmd.AddCommand(storageCmd)
+	rootCmd.AddCommand(outboxCmd)
+	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(showHistoryCmd)
+	rootCmd.AddCommand(roomsCmd)
+	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(watchCmd)
 
 	// Execute the root command
 	if err := rootCmd.Execute(); err != nil {
@@ -2,11 +2,13 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func TestRootCommand(t *testing.T) {
@@ -147,3 +149,48 @@ func TestRootCommand(t *testing.T) {
 		})
 	}
 }
+
+// runCommand executes a command under a fresh root, with its flags back to
+// their defaults and the given stdin, and returns its output
+func runCommand(t *testing.T, cmd *cobra.Command, stdin string, args ...string) string {
+	resetFlags(cmd)
+
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	rIn, wIn, _ := os.Pipe()
+	rOut, wOut, _ := os.Pipe()
+	os.Stdin, os.Stdout = rIn, wOut
+	io.WriteString(wIn, stdin)
+	wIn.Close()
+
+	rootCmd := &cobra.Command{Use: "test"}
+	rootCmd.AddCommand(cmd)
+	rootCmd.SetArgs(append([]string{cmd.Name()}, args...))
+	err := rootCmd.Execute()
+
+	wOut.Close()
+	os.Stdin, os.Stdout = oldStdin, oldStdout
+	rIn.Close()
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	out, _ := io.ReadAll(rOut)
+	return string(out)
+}
+
+// resetFlags sets the flags of a command and its subcommands back to their
+// defaults, as the variables they're bound to outlive each test
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// mcpProtocolVersions lists the MCP revisions this server understands, newest first
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+type jsonRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type jsonRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type jsonRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *jsonRPCError   `json:"error,omitempty"`
+}
+
+// JSON-RPC error codes used by the MCP server
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// mcpTool is a tool exposed to MCP clients, backed by a NomiClient call
+type mcpTool struct {
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	InputSchema  map[string]interface{} `json:"inputSchema"`
+	OutputSchema map[string]interface{} `json:"outputSchema"`
+	call         func(args map[string]string) (interface{}, error)
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content           []mcpContent `json:"content"`
+	StructuredContent interface{}  `json:"structuredContent,omitempty"`
+	IsError           bool         `json:"isError,omitempty"`
+}
+
+// jsonSchema derives a JSON schema from a Go type using its json struct tags
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return jsonSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if !field.IsExported() || tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = jsonSchema(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// mcpInputSchema builds an object schema whose properties are all required strings
+func mcpInputSchema(descriptions ...string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i+1 < len(descriptions); i += 2 {
+		properties[descriptions[i]] = map[string]interface{}{"type": "string", "description": descriptions[i+1]}
+		required = append(required, descriptions[i])
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+// resolveNomi finds a Nomi by name or UUID
+func resolveNomi(ref string) (Nomi, error) {
+	nomis, err := client.GetNomis()
+	if err != nil {
+		return Nomi{}, err
+	}
+	nomi, ok := findNomi(nomis, ref)
+	if !ok {
+		return Nomi{}, fmt.Errorf("no Nomi found with the name or ID: %s", ref)
+	}
+	return nomi, nil
+}
+
+// resolveRoom finds a room by name or UUID
+func resolveRoom(ref string) (Room, error) {
+	rooms, err := client.GetRooms()
+	if err != nil {
+		return Room{}, err
+	}
+	for _, room := range rooms {
+		if room.UUID == ref || strings.EqualFold(room.Name, ref) {
+			return room, nil
+		}
+	}
+	return Room{}, fmt.Errorf("no room found with the name or ID: %s", ref)
+}
+
+// mcpTools returns the tools exposed by the MCP server
+func mcpTools() []mcpTool {
+	nomiSchema := jsonSchema(reflect.TypeOf(Nomi{}))
+	chatSchema := jsonSchema(reflect.TypeOf(ChatResponse{}))
+
+	return []mcpTool{
+		{
+			Name:         "list_nomis",
+			Description:  "List all Nomis on the account",
+			InputSchema:  mcpInputSchema(),
+			OutputSchema: jsonSchema(reflect.TypeOf(NomiResponse{})),
+			call: func(args map[string]string) (interface{}, error) {
+				nomis, err := client.GetNomis()
+				if err != nil {
+					return nil, err
+				}
+				return NomiResponse{Nomis: nomis}, nil
+			},
+		},
+		{
+			Name:         "get_nomi",
+			Description:  "Get details of a Nomi by name or ID",
+			InputSchema:  mcpInputSchema("nomi", "Name or UUID of the Nomi"),
+			OutputSchema: nomiSchema,
+			call: func(args map[string]string) (interface{}, error) {
+				nomi, err := resolveNomi(args["nomi"])
+				if err != nil {
+					return nil, err
+				}
+				return client.GetNomi(nomi.UUID)
+			},
+		},
+		{
+			Name:         "list_rooms",
+			Description:  "List all rooms and their Nomis",
+			InputSchema:  mcpInputSchema(),
+			OutputSchema: jsonSchema(reflect.TypeOf(RoomResponse{})),
+			call: func(args map[string]string) (interface{}, error) {
+				rooms, err := client.GetRooms()
+				if err != nil {
+					return nil, err
+				}
+				return RoomResponse{Rooms: rooms}, nil
+			},
+		},
+		{
+			Name:         "send_message",
+			Description:  "Send a message to a Nomi and return its reply",
+			InputSchema:  mcpInputSchema("nomi", "Name or UUID of the Nomi", "message", "Message text to send"),
+			OutputSchema: chatSchema,
+			call: func(args map[string]string) (interface{}, error) {
+				nomi, err := resolveNomi(args["nomi"])
+				if err != nil {
+					return nil, err
+				}
+				return sendMessage("mcp", nomi, args["message"])
+			},
+		},
+		{
+			Name:         "send_room_message",
+			Description:  "Post a message to a room",
+			InputSchema:  mcpInputSchema("room", "Name or UUID of the room", "message", "Message text to send"),
+			OutputSchema: chatSchema,
+			call: func(args map[string]string) (interface{}, error) {
+				room, err := resolveRoom(args["room"])
+				if err != nil {
+					return nil, err
+				}
+				return sendRoomMessage("mcp", room, args["message"])
+			},
+		},
+		{
+			Name:         "request_room_reply",
+			Description:  "Ask a Nomi in a room to reply to the conversation",
+			InputSchema:  mcpInputSchema("room", "Name or UUID of the room", "nomi", "Name or UUID of the Nomi that should reply"),
+			OutputSchema: chatSchema,
+			call: func(args map[string]string) (interface{}, error) {
+				room, err := resolveRoom(args["room"])
+				if err != nil {
+					return nil, err
+				}
+				nomi, ok := findNomi(room.Nomis, args["nomi"])
+				if !ok {
+					return nil, fmt.Errorf("no Nomi %s in room %s", args["nomi"], room.Name)
+				}
+				return requestRoomReply("mcp", room, nomi)
+			},
+		},
+	}
+}
+
+// mcpServer answers MCP requests read line by line from a stdio transport
+type mcpServer struct {
+	tools []mcpTool
+	out   *json.Encoder
+}
+
+// callTool runs a tool, reporting failures as tool errors rather than protocol errors
+func (s *mcpServer) callTool(params json.RawMessage) (interface{}, *jsonRPCError) {
+	var call struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, &jsonRPCError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+
+	for _, tool := range s.tools {
+		if tool.Name != call.Name {
+			continue
+		}
+
+		// Every tool argument is a string: null counts as missing, and other
+		// types are refused rather than formatted into an ID or message
+		args := map[string]string{}
+		for key, value := range call.Arguments {
+			switch value := value.(type) {
+			case nil:
+			case string:
+				args[key] = value
+			default:
+				return mcpToolResult{Content: []mcpContent{{Type: "text", Text: fmt.Sprintf("argument %s must be a string", key)}}, IsError: true}, nil
+			}
+		}
+		for _, name := range tool.InputSchema["required"].([]string) {
+			if strings.TrimSpace(args[name]) == "" {
+				return mcpToolResult{Content: []mcpContent{{Type: "text", Text: "missing argument: " + name}}, IsError: true}, nil
+			}
+		}
+
+		result, err := tool.call(args)
+		if err != nil {
+			return mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+		}
+		text, _ := json.MarshalIndent(result, "", "  ")
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: string(text)}}, StructuredContent: result}, nil
+	}
+
+	return nil, &jsonRPCError{Code: rpcInvalidParams, Message: "unknown tool: " + call.Name}
+}
+
+// initialize negotiates the protocol version and advertises server capabilities
+func (s *mcpServer) initialize(params json.RawMessage) interface{} {
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	json.Unmarshal(params, &init)
+
+	version := mcpProtocolVersions[0]
+	for _, supported := range mcpProtocolVersions {
+		if supported == init.ProtocolVersion {
+			version = supported
+		}
+	}
+
+	return map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+		"serverInfo":      map[string]string{"name": "nomi-cli", "version": Version},
+	}
+}
+
+// handle dispatches a single request; notifications get no response
+func (s *mcpServer) handle(req jsonRPCRequest) {
+	var result interface{}
+	var rpcErr *jsonRPCError
+
+	switch req.Method {
+	case "initialize":
+		result = s.initialize(req.Params)
+	case "ping":
+		result = map[string]interface{}{}
+	case "tools/list":
+		result = map[string]interface{}{"tools": s.tools}
+	case "tools/call":
+		result, rpcErr = s.callTool(req.Params)
+	default:
+		rpcErr = &jsonRPCError{Code: rpcMethodNotFound, Message: "method not found: " + req.Method}
+	}
+
+	if len(req.ID) == 0 {
+		return
+	}
+	s.out.Encode(jsonRPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr})
+}
+
+// serveMCP runs the MCP server until in is exhausted
+func serveMCP(in io.Reader, out io.Writer) error {
+	s := &mcpServer{tools: mcpTools(), out: json.NewEncoder(out)}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var req jsonRPCRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			s.out.Encode(jsonRPCResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &jsonRPCError{Code: rpcParseError, Message: err.Error()}})
+			continue
+		}
+		s.handle(req)
+	}
+	return scanner.Err()
+}
+
+// errMCPPrompt is returned instead of prompting for a passphrase, as stdin
+// carries the client's requests
+var errMCPPrompt = errors.New("storage is locked and stdin is the MCP connection: set NOMI_PASSPHRASE or run 'nomi-cli storage unlock'")
+
+var mcpCmd = &cobra.Command{
+	Use:         "mcp",
+	Short:       "Run a Model Context Protocol server over stdio exposing Nomis as tools",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"apiKey": "optional"}, // Set up below, once prompts are disabled
+	Run: func(cmd *cobra.Command, args []string) {
+		// Reading a passphrase from stdin would swallow the client's requests
+		readSecret = func(prompt string) (string, error) { return "", errMCPPrompt }
+		defer func() { readSecret = nil }()
+
+		// Stdout carries the protocol, so diagnostics go to stderr
+		if err := setupClient(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return
+		}
+		if err := openArchive(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening message archive:", err)
+			return
+		}
+		if err := serveMCP(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "Error running MCP server:", err)
+		}
+	},
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// runMCP feeds requests to the MCP server and returns the decoded responses
+func runMCP(t *testing.T, requests ...string) []jsonRPCResponse {
+	var out bytes.Buffer
+	if err := serveMCP(strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var responses []jsonRPCResponse
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var resp jsonRPCResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			t.Fatalf("Error decoding response %q: %v", scanner.Text(), err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+// toolText extracts the text content of a tools/call result
+func toolText(t *testing.T, resp jsonRPCResponse) (string, bool) {
+	data, _ := json.Marshal(resp.Result)
+	var result mcpToolResult
+	if err := json.Unmarshal(data, &result); err != nil || len(result.Content) == 0 {
+		t.Fatalf("Unexpected tool result: %s", data)
+	}
+	return result.Content[0].Text, result.IsError
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema := jsonSchema(reflect.TypeOf(Room{}))
+	properties := schema["properties"].(map[string]interface{})
+
+	if schema["type"] != "object" {
+		t.Errorf("Expected object schema, got %v", schema["type"])
+	}
+	if properties["backchannelingEnabled"].(map[string]interface{})["type"] != "boolean" {
+		t.Errorf("Expected boolean backchannelingEnabled, got %v", properties["backchannelingEnabled"])
+	}
+	nomis := properties["nomis"].(map[string]interface{})
+	if nomis["type"] != "array" || nomis["items"].(map[string]interface{})["type"] != "object" {
+		t.Errorf("Expected array of objects for nomis, got %v", nomis)
+	}
+	if len(schema["required"].([]string)) != 8 {
+		t.Errorf("Expected all 8 fields to be required, got %v", schema["required"])
+	}
+}
+
+func TestMCPInitializeAndList(t *testing.T) {
+	responses := runMCP(t,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"resources/list"}`,
+		`not json`,
+	)
+
+	if len(responses) != 4 {
+		t.Fatalf("Expected 4 responses (no reply to the notification), got %d", len(responses))
+	}
+
+	init, _ := json.Marshal(responses[0].Result)
+	if !strings.Contains(string(init), `"protocolVersion":"2025-03-26"`) {
+		t.Errorf("Expected negotiated protocol version, got %s", init)
+	}
+
+	tools, _ := json.Marshal(responses[1].Result)
+	for _, name := range []string{"list_nomis", "get_nomi", "list_rooms", "send_message", "send_room_message", "request_room_reply"} {
+		if !strings.Contains(string(tools), `"name":"`+name+`"`) {
+			t.Errorf("Expected tool %s in %s", name, tools)
+		}
+	}
+
+	if responses[2].Error == nil || responses[2].Error.Code != rpcMethodNotFound {
+		t.Errorf("Expected method not found error, got %+v", responses[2])
+	}
+	if responses[3].Error == nil || responses[3].Error.Code != rpcParseError {
+		t.Errorf("Expected parse error, got %+v", responses[3])
+	}
+}
+
+func TestMCPToolCalls(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	tests := []struct {
+		name          string
+		request       string
+		expectedText  string
+		expectedError bool
+	}{
+		{"list nomis", `{"name":"list_nomis"}`, `"name": "Bob"`, false},
+		{"get nomi", `{"name":"get_nomi","arguments":{"nomi":"alice"}}`, `"uuid": "a11ce000-0000-4000-8000-000000000000"`, false},
+		{"list rooms", `{"name":"list_rooms","arguments":{}}`, `"name": "Everyone"`, false},
+		{"send message", `{"name":"send_message","arguments":{"nomi":"Alice","message":"Hi"}}`, "Hello there friend", false},
+		{"send room message", `{"name":"send_room_message","arguments":{"room":"Alice only","message":"Hi all"}}`, "Hi all", false},
+		{"request room reply", `{"name":"request_room_reply","arguments":{"room":"room-1","nomi":"Alice"}}`, "Reply from a11ce000-0000-4000-8000-000000000000", false},
+		{"missing argument", `{"name":"send_message","arguments":{"nomi":"Alice"}}`, "missing argument: message", true},
+		{"null argument", `{"name":"send_message","arguments":{"nomi":null,"message":"Hi"}}`, "missing argument: nomi", true},
+		{"non-string argument", `{"name":"send_message","arguments":{"nomi":"Alice","message":42}}`, "argument message must be a string", true},
+		{"unknown Nomi", `{"name":"get_nomi","arguments":{"nomi":"Nobody"}}`, "no Nomi found", true},
+		{"Nomi not in room", `{"name":"request_room_reply","arguments":{"room":"room-1","nomi":"Bob"}}`, "no Nomi Bob in room", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			responses := runMCP(t, `{"jsonrpc":"2.0","id":"call","method":"tools/call","params":`+tc.request+`}`)
+			if len(responses) != 1 || responses[0].Error != nil {
+				t.Fatalf("Expected a single successful response, got %+v", responses)
+			}
+
+			text, isError := toolText(t, responses[0])
+			if isError != tc.expectedError {
+				t.Errorf("Expected isError=%v, got %v (%s)", tc.expectedError, isError, text)
+			}
+			if !strings.Contains(text, tc.expectedText) {
+				t.Errorf("Expected %q in tool output, got %q", tc.expectedText, text)
+			}
+		})
+	}
+}
+
+func TestMCPCommandNeverPromptsOnStdin(t *testing.T) {
+	setupArchiveTest(t)
+	oldAPIKey := apiKey
+	apiKey = "test-api-key"
+	defer func() { apiKey = oldAPIKey }()
+
+	// Create the encrypted storage, then forget its passphrase
+	if _, err := openStore(); err != nil {
+		t.Fatalf("Expected storage to be created, got %v", err)
+	}
+	store = nil
+	t.Setenv("NOMI_PASSPHRASE", "")
+
+	request := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}` + "\n"
+	stdinR, stdinW, _ := os.Pipe()
+	stdinW.WriteString(request)
+	stdinW.Close()
+	stderrR, stderrW, _ := os.Pipe()
+	oldStdin, oldStderr := os.Stdin, os.Stderr
+	os.Stdin, os.Stderr = stdinR, stderrW
+
+	rootCmd := &cobra.Command{Use: "test"}
+	rootCmd.AddCommand(mcpCmd)
+	rootCmd.SetArgs([]string{"mcp"})
+	err := rootCmd.Execute()
+
+	stderrW.Close()
+	os.Stdin, os.Stderr = oldStdin, oldStderr
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	if output, _ := io.ReadAll(stderrR); !strings.Contains(string(output), "storage is locked") {
+		t.Errorf("Expected a locked storage error, got %q", output)
+	}
+	if unread, _ := io.ReadAll(stdinR); string(unread) != request {
+		t.Errorf("Expected the client's request to be left on stdin, got %q", unread)
+	}
+	if readSecret != nil {
+		t.Error("Expected prompts to be restored")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// sendMessage sends a message to a Nomi on behalf of the named command,
+// firing the message and error hooks around the API call and archiving
+// the exchange when the archive is enabled.
+func sendMessage(source string, nomi Nomi, text string) (*ChatResponse, error) {
+	return sendMessageContext(context.Background(), source, nomi, text)
+}
+
+// sendMessageContext is sendMessage with a context for tracing, e.g.
+// carrying the retry count of a queued message
+func sendMessageContext(ctx context.Context, source string, nomi Nomi, text string) (*ChatResponse, error) {
+	chatResponse, err := client.SendMessageContext(ctx, nomi.UUID, text)
+	if err != nil {
+		fireHook(HookEvent{Event: eventError, Source: source, NomiUUID: nomi.UUID, NomiName: nomi.Name, Error: err.Error()})
+		return nil, err
+	}
+
+	fireHook(HookEvent{Event: eventMessageSent, Source: source, NomiUUID: nomi.UUID, NomiName: nomi.Name, Message: &chatResponse.SentMessage})
+	fireHook(HookEvent{Event: eventMessageReceived, Source: source, NomiUUID: nomi.UUID, NomiName: nomi.Name, Message: &chatResponse.ReplyMessage})
+	if err := archiveExchange(nomi, chatResponse); err != nil {
+		fmt.Fprintln(os.Stderr, "Error archiving message:", err)
+	}
+	return chatResponse, nil
+}
+
+// sendRoomMessage posts a message to a room on behalf of the named command,
+// firing the message and error hooks around the API call and archiving the
+// message when the archive is enabled
+func sendRoomMessage(source string, room Room, text string) (*ChatResponse, error) {
+	chatResponse, err := client.SendRoomMessage(room.UUID, text)
+	if err != nil {
+		fireHook(HookEvent{Event: eventError, Source: source, RoomUUID: room.UUID, RoomName: room.Name, Error: err.Error()})
+		return nil, err
+	}
+
+	fireHook(HookEvent{Event: eventMessageSent, Source: source, RoomUUID: room.UUID, RoomName: room.Name, Message: &chatResponse.SentMessage})
+	if err := appendToArchive(archivedMessage{RoomUUID: room.UUID, RoomName: room.Name, Speaker: speakerUser, Message: chatResponse.SentMessage}); err != nil {
+		fmt.Fprintln(os.Stderr, "Error archiving message:", err)
+	}
+	return chatResponse, nil
+}
+
+// requestRoomReply asks a Nomi in a room to reply on behalf of the named
+// command, firing the message and error hooks around the API call and
+// archiving the reply when the archive is enabled
+func requestRoomReply(source string, room Room, nomi Nomi) (*ChatResponse, error) {
+	chatResponse, err := client.RequestRoomReply(room.UUID, nomi.UUID)
+	if err != nil {
+		fireHook(HookEvent{Event: eventError, Source: source, NomiUUID: nomi.UUID, NomiName: nomi.Name, RoomUUID: room.UUID, RoomName: room.Name, Error: err.Error()})
+		return nil, err
+	}
+
+	fireHook(HookEvent{Event: eventMessageReceived, Source: source, NomiUUID: nomi.UUID, NomiName: nomi.Name, RoomUUID: room.UUID, RoomName: room.Name, Message: &chatResponse.ReplyMessage})
+	reply := archivedMessage{NomiUUID: nomi.UUID, NomiName: nomi.Name, RoomUUID: room.UUID, RoomName: room.Name, Speaker: speakerNomi, Message: chatResponse.ReplyMessage}
+	if err := appendToArchive(reply); err != nil {
+		fmt.Fprintln(os.Stderr, "Error archiving message:", err)
+	}
+	return chatResponse, nil
+}
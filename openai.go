@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// openAIModel describes a Nomi in the OpenAI /v1/models format
+type openAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type openAIModelList struct {
+	Object string        `json:"object"`
+	Data   []openAIModel `json:"data"`
+}
+
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type openAIChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+type openAIReply struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type openAIChoice struct {
+	Index        int          `json:"index"`
+	Message      *openAIReply `json:"message,omitempty"`
+	Delta        *openAIReply `json:"delta,omitempty"`
+	FinishReason *string      `json:"finish_reason"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type openAIChatResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+}
+
+type openAIErrorBody struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+type openAIError struct {
+	Error openAIErrorBody `json:"error"`
+}
+
+// registerOpenAIRoutes mounts the OpenAI-compatible endpoints on mux,
+// open to anyone who can reach the server
+func registerOpenAIRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/models", func(w http.ResponseWriter, r *http.Request) {
+		handleOpenAIModels(w, r, nil)
+	})
+	mux.HandleFunc("POST /v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		handleOpenAIChatCompletions(w, r, nil)
+	})
+}
+
+// writeOpenAIError reports an error using the OpenAI error envelope
+func writeOpenAIError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, openAIError{Error: openAIErrorBody{Message: message, Type: errType}})
+}
+
+// writeOpenAIUpstreamError maps a Nomi API failure to an OpenAI error response
+func writeOpenAIUpstreamError(w http.ResponseWriter, err error) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		writeOpenAIError(w, apiErr.StatusCode, "upstream_error", apiErr.Error())
+		return
+	}
+	writeOpenAIError(w, http.StatusBadGateway, "upstream_error", err.Error())
+}
+
+// nomiCreatedUnix converts a Nomi creation date to a Unix timestamp, or 0 if unparseable
+func nomiCreatedUnix(created string) int64 {
+	t, err := time.Parse(time.RFC3339, created)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// findNomi resolves a reference to a Nomi, matching either the name or the UUID
+func findNomi(nomis []Nomi, ref string) (Nomi, bool) {
+	for _, nomi := range nomis {
+		if nomi.UUID == ref || strings.EqualFold(nomi.Name, ref) {
+			return nomi, true
+		}
+	}
+	return Nomi{}, false
+}
+
+// messageText extracts the text of an OpenAI message, whose content is
+// either a plain string or an array of typed content parts.
+func messageText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return ""
+	}
+
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// lastUserMessage returns the text of the most recent user message
+func lastUserMessage(messages []openAIMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messageText(messages[i].Content)
+		}
+	}
+	return ""
+}
+
+// handleOpenAIModels lists the Nomis as models. When allows is not nil,
+// only the Nomis it accepts are listed.
+func handleOpenAIModels(w http.ResponseWriter, r *http.Request, allows func(Nomi) bool) {
+	nomis, err := client.GetNomis()
+	if err != nil {
+		writeOpenAIUpstreamError(w, err)
+		return
+	}
+
+	list := openAIModelList{Object: "list", Data: []openAIModel{}}
+	for _, nomi := range nomis {
+		if allows != nil && !allows(nomi) {
+			continue
+		}
+		list.Data = append(list.Data, openAIModel{
+			ID:      nomi.Name,
+			Object:  "model",
+			Created: nomiCreatedUnix(nomi.Created),
+			OwnedBy: "nomi",
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleOpenAIChatCompletions sends the last user message to the Nomi named
+// by the model. When allows is not nil, other Nomis are refused.
+func handleOpenAIChatCompletions(w http.ResponseWriter, r *http.Request, allows func(Nomi) bool) {
+	var req openAIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON body: "+err.Error())
+		return
+	}
+
+	text := lastUserMessage(req.Messages)
+	if strings.TrimSpace(text) == "" {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "no user message to send")
+		return
+	}
+
+	nomis, err := client.GetNomis()
+	if err != nil {
+		writeOpenAIUpstreamError(w, err)
+		return
+	}
+	nomi, ok := findNomi(nomis, req.Model)
+	if !ok {
+		writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("model %q does not match any Nomi", req.Model))
+		return
+	}
+	if allows != nil && !allows(nomi) {
+		writeOpenAIError(w, http.StatusForbidden, "permission_error", fmt.Sprintf("this token may not access model %q", req.Model))
+		return
+	}
+
+	chatResponse, err := sendMessage("serve", nomi, text)
+	if err != nil {
+		writeOpenAIUpstreamError(w, err)
+		return
+	}
+
+	id := "chatcmpl-" + chatResponse.ReplyMessage.UUID
+	created := time.Now().Unix()
+	if req.Stream {
+		streamOpenAIReply(w, id, created, nomi.Name, chatResponse.ReplyMessage.Text)
+		return
+	}
+
+	stop := "stop"
+	writeJSON(w, http.StatusOK, openAIChatResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   nomi.Name,
+		Choices: []openAIChoice{{
+			Index:        0,
+			Message:      &openAIReply{Role: "assistant", Content: chatResponse.ReplyMessage.Text},
+			FinishReason: &stop,
+		}},
+		Usage: &openAIUsage{},
+	})
+}
+
+// streamOpenAIReply simulates a streamed completion by sending the reply
+// word by word as server-sent events, as the Nomi API returns it in one piece.
+func streamOpenAIReply(w http.ResponseWriter, id string, created int64, model, text string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	send := func(choice openAIChoice) {
+		chunk := openAIChatResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []openAIChoice{choice},
+		}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	send(openAIChoice{Delta: &openAIReply{Role: "assistant"}})
+	for _, word := range strings.SplitAfter(text, " ") {
+		if word == "" {
+			continue
+		}
+		send(openAIChoice{Delta: &openAIReply{Content: word}})
+	}
+	stop := "stop"
+	send(openAIChoice{Delta: &openAIReply{}, FinishReason: &stop})
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
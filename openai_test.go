@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newMockNomiServer mocks the Nomi API endpoints used by the local gateways
+func newMockNomiServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		nomis := []Nomi{
+			{UUID: "a11ce000-0000-4000-8000-000000000000", Name: "Alice", Created: "2024-01-01T12:00:00Z", RelationshipType: "Friend"},
+			{UUID: "b0b00000-0000-4000-8000-000000000000", Name: "Bob", Created: "2024-01-02T12:00:00Z", RelationshipType: "Mentor"},
+		}
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/nomis":
+			json.NewEncoder(w).Encode(NomiResponse{Nomis: nomis})
+		case r.Method == "GET" && r.URL.Path == "/nomis/a11ce000-0000-4000-8000-000000000000":
+			json.NewEncoder(w).Encode(nomis[0])
+		case r.Method == "GET" && r.URL.Path == "/nomis/b0b00000-0000-4000-8000-000000000000":
+			json.NewEncoder(w).Encode(nomis[1])
+		case r.Method == "GET" && r.URL.Path == "/rooms":
+			json.NewEncoder(w).Encode(RoomResponse{Rooms: []Room{
+				{UUID: "room-1", Name: "Alice only", Nomis: nomis[:1]},
+				{UUID: "room-2", Name: "Everyone", Nomis: nomis},
+			}})
+		case r.Method == "POST" && r.URL.Path == "/nomis/a11ce000-0000-4000-8000-000000000000/chat":
+			var chatReq ChatRequest
+			json.NewDecoder(r.Body).Decode(&chatReq)
+			json.NewEncoder(w).Encode(ChatResponse{
+				SentMessage:  Message{UUID: "msg-1", Text: chatReq.MessageText, Sent: "2024-01-01T12:00:00Z"},
+				ReplyMessage: Message{UUID: "msg-2", Text: "Hello there friend", Sent: "2024-01-01T12:00:01Z"},
+			})
+		case r.Method == "POST" && r.URL.Path == "/rooms":
+			var roomReq RoomRequest
+			json.NewDecoder(r.Body).Decode(&roomReq)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(Room{UUID: "room-3", Name: roomReq.Name})
+		case r.Method == "PUT" && r.URL.Path == "/rooms/room-1":
+			var roomReq RoomRequest
+			json.NewDecoder(r.Body).Decode(&roomReq)
+			json.NewEncoder(w).Encode(Room{UUID: "room-1", Name: roomReq.Name})
+		case r.Method == "DELETE" && r.URL.Path == "/rooms/room-1":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "POST" && r.URL.Path == "/rooms/room-1/chat":
+			var chatReq ChatRequest
+			json.NewDecoder(r.Body).Decode(&chatReq)
+			json.NewEncoder(w).Encode(ChatResponse{SentMessage: Message{UUID: "msg-3", Text: chatReq.MessageText}})
+		case r.Method == "POST" && r.URL.Path == "/rooms/room-1/chat/request":
+			var replyReq RoomReplyRequest
+			json.NewDecoder(r.Body).Decode(&replyReq)
+			json.NewEncoder(w).Encode(ChatResponse{ReplyMessage: Message{UUID: "msg-4", Text: "Reply from " + replyReq.NomiUUID}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestOpenAIModels(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	server := httptest.NewServer(newServeMux(true, nil))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v1/models")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	var list openAIModelList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	if list.Object != "list" || len(list.Data) != 2 {
+		t.Fatalf("Expected a list of 2 models, got %+v", list)
+	}
+	if list.Data[0].ID != "Alice" || list.Data[0].Created != 1704110400 {
+		t.Errorf("First model doesn't match expected values: %+v", list.Data[0])
+	}
+}
+
+func TestOpenAIChatCompletions(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	server := httptest.NewServer(newServeMux(true, nil))
+	defer server.Close()
+
+	body := `{"model":"alice","messages":[
+		{"role":"system","content":"ignored"},
+		{"role":"user","content":[{"type":"text","text":"Hi Alice"}]}
+	]}`
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	var completion openAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	if completion.Object != "chat.completion" || completion.ID != "chatcmpl-msg-2" || completion.Model != "Alice" {
+		t.Errorf("Unexpected completion envelope: %+v", completion)
+	}
+	if len(completion.Choices) != 1 || completion.Choices[0].Message.Content != "Hello there friend" {
+		t.Errorf("Unexpected choices: %+v", completion.Choices)
+	}
+}
+
+func TestOpenAIChatCompletionsStream(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	server := httptest.NewServer(newServeMux(true, nil))
+	defer server.Close()
+
+	body := `{"model":"a11ce000-0000-4000-8000-000000000000","stream":true,"messages":[{"role":"user","content":"Hi"}]}`
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	var text strings.Builder
+	var done bool
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("Error decoding chunk %q: %v", data, err)
+		}
+		text.WriteString(chunk.Choices[0].Delta.Content)
+	}
+
+	if !done {
+		t.Error("Expected stream to end with [DONE]")
+	}
+	if text.String() != "Hello there friend" {
+		t.Errorf("Expected streamed text %q, got %q", "Hello there friend", text.String())
+	}
+}
+
+func TestOpenAIChatCompletionsErrors(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	server := httptest.NewServer(newServeMux(true, nil))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{"unknown model", `{"model":"Nobody","messages":[{"role":"user","content":"Hi"}]}`, http.StatusNotFound},
+		{"no user message", `{"model":"Alice","messages":[{"role":"system","content":"Hi"}]}`, http.StatusBadRequest},
+		{"invalid JSON", `{`, http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+
+			var apiErr openAIError
+			if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error.Message == "" {
+				t.Errorf("Expected an OpenAI error body, got %+v (%v)", apiErr, err)
+			}
+		})
+	}
+}
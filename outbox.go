@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// outboxName is the encrypted file holding messages waiting to be sent
+const outboxName = "outbox"
+
+// outboxLockName is the file locked while a process updates the outbox
+const outboxLockName = "outbox.lock"
+
+// outboxRetryInterval is how often a chat retries its pending messages
+const outboxRetryInterval = 30 * time.Second
+
+// outboxClaimTimeout is how long messages claimed by a flush stay out of
+// reach of other flushes, in case the process claiming them died
+const outboxClaimTimeout = 30 * time.Minute
+
+// outboxItem is a message that could not be sent and waits for a retry
+type outboxItem struct {
+	ID        string    `json:"id"`
+	NomiUUID  string    `json:"nomiUuid"`
+	NomiName  string    `json:"nomiName"`
+	Text      string    `json:"text"`
+	Queued    time.Time `json:"queued"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+	Failed    bool      `json:"failed,omitempty"` // Rejected by the API, so never retried
+
+	// Set while a flush is sending the message, so no other one sends it too
+	ClaimedBy string    `json:"claimedBy,omitempty"`
+	ClaimedAt time.Time `json:"claimedAt"`
+}
+
+// claimed reports whether another flush is sending the message
+func (item outboxItem) claimed(now time.Time) bool {
+	return item.ClaimedBy != "" && now.Sub(item.ClaimedAt) < outboxClaimTimeout
+}
+
+// outboxMu serializes outbox updates between a chat and its background retries
+var outboxMu sync.Mutex
+
+// lockOutbox serializes outbox updates between goroutines and between
+// processes, such as a chat and the daemon, so that neither overwrites
+// messages the other queued nor sends the same message twice
+func lockOutbox(s *secureStore) (func(), error) {
+	outboxMu.Lock()
+	unlock, err := lockFile(filepath.Join(s.dir, outboxLockName))
+	if err != nil {
+		outboxMu.Unlock()
+		return nil, fmt.Errorf("error locking outbox: %w", err)
+	}
+	return func() {
+		unlock()
+		outboxMu.Unlock()
+	}, nil
+}
+
+// retryableError reports whether a failed send may succeed later: the API
+// was unreachable, rate limited or failing, as opposed to rejecting the message.
+func retryableError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == 429 || apiErr.StatusCode >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// outboxExists reports whether any messages were ever queued, so the
+// storage passphrase is only asked for when there is something to read.
+func outboxExists() bool {
+	dir, err := dataDir()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(dir, outboxName+storageSuffix))
+	return err == nil
+}
+
+// loadOutbox reads the queued messages, oldest first
+func loadOutbox(s *secureStore) ([]outboxItem, error) {
+	data, err := s.readFile(outboxName)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var items []outboxItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("error parsing outbox: %w", err)
+	}
+	return items, nil
+}
+
+// saveOutbox replaces the queued messages
+func saveOutbox(s *secureStore, items []outboxItem) error {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("error marshaling outbox: %w", err)
+	}
+	return s.writeFile(outboxName, data)
+}
+
+// enqueueMessage adds a message that could not be sent to the outbox,
+// with the number of times sending it was tried and why it failed
+func enqueueMessage(s *secureStore, nomi Nomi, text string, attempts int, sendErr error) (outboxItem, error) {
+	item := outboxItem{
+		ID:        newOutboxID(),
+		NomiUUID:  nomi.UUID,
+		NomiName:  nomi.Name,
+		Text:      text,
+		Queued:    time.Now().UTC(),
+		Attempts:  attempts,
+		LastError: sendErr.Error(),
+	}
+
+	unlock, err := lockOutbox(s)
+	if err != nil {
+		return item, err
+	}
+	defer unlock()
+
+	items, err := loadOutbox(s)
+	if err != nil {
+		return item, err
+	}
+	return item, saveOutbox(s, append(items, item))
+}
+
+// newOutboxID returns a random ID for a message or a flush
+func newOutboxID() string {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// pendingFor returns the messages waiting to be retried for a Nomi, or for
+// all of them for an empty UUID
+func pendingFor(items []outboxItem, nomiUUID string) []outboxItem {
+	var pending []outboxItem
+	for _, item := range items {
+		if !item.Failed && (nomiUUID == "" || item.NomiUUID == nomiUUID) {
+			pending = append(pending, item)
+		}
+	}
+	return pending
+}
+
+// flushOutbox sends the queued messages in the order they were queued, for
+// one Nomi or all of them, calling delivered for each reply. A Nomi's
+// remaining messages wait after one of them fails to go through, so they
+// never arrive out of order; a message the API rejects is kept as failed
+// instead, without holding up the others. It returns the number of
+// messages sent.
+//
+// The outbox is only locked to claim the messages and to record the
+// results, not while sending, so a slow API doesn't hold up chats queueing
+// messages or other flushes, which skip the claimed messages.
+func flushOutbox(s *secureStore, source, nomiUUID string, delivered func(outboxItem, *ChatResponse)) (int, error) {
+	claim, err := claimOutbox(s, nomiUUID)
+	if err != nil || len(claim) == 0 {
+		return 0, err
+	}
+
+	sent := 0
+	results := map[string]*outboxItem{} // Messages tried, nil once sent
+	blocked := map[string]bool{}        // Nomis with a message that failed again
+	for _, item := range claim {
+		if blocked[item.NomiUUID] {
+			continue
+		}
+
+		ctx := withRetryCount(context.Background(), item.Attempts)
+		chatResponse, err := sendMessageContext(ctx, source, Nomi{UUID: item.NomiUUID, Name: item.NomiName}, item.Text)
+		if err != nil {
+			item.Attempts++
+			item.LastError = err.Error()
+			if retryableError(err) {
+				blocked[item.NomiUUID] = true
+			} else {
+				item.Failed = true
+			}
+			results[item.ID] = &item
+			continue
+		}
+
+		sent++
+		results[item.ID] = nil
+		if delivered != nil {
+			delivered(item, chatResponse)
+		}
+	}
+
+	return sent, releaseOutbox(s, claim[0].ClaimedBy, results)
+}
+
+// claimOutbox marks the messages a flush may send, oldest first, and
+// returns them. A Nomi's messages queued after one claimed by another
+// flush are left to that flush, to keep them in order.
+func claimOutbox(s *secureStore, nomiUUID string) ([]outboxItem, error) {
+	unlock, err := lockOutbox(s)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	items, err := loadOutbox(s)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	flush := newOutboxID()
+	busy := map[string]bool{} // Nomis with messages claimed by another flush
+	var claim []outboxItem
+	for i, item := range items {
+		if item.Failed || (nomiUUID != "" && item.NomiUUID != nomiUUID) || busy[item.NomiUUID] {
+			continue
+		}
+		if item.claimed(now) {
+			busy[item.NomiUUID] = true
+			continue
+		}
+		items[i].ClaimedBy, items[i].ClaimedAt = flush, now
+		claim = append(claim, items[i])
+	}
+	if len(claim) == 0 {
+		return nil, nil
+	}
+	return claim, saveOutbox(s, items)
+}
+
+// releaseOutbox records the results of a flush: sent messages are removed
+// and the others updated and released. Messages queued or dropped while
+// sending are left as they are.
+func releaseOutbox(s *secureStore, flush string, results map[string]*outboxItem) error {
+	unlock, err := lockOutbox(s)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	items, err := loadOutbox(s)
+	if err != nil {
+		return err
+	}
+
+	var remaining []outboxItem
+	for _, item := range items {
+		if item.ClaimedBy != flush {
+			remaining = append(remaining, item)
+			continue
+		}
+		if result, tried := results[item.ID]; tried {
+			if result == nil {
+				continue // Sent
+			}
+			item = *result
+		}
+		item.ClaimedBy, item.ClaimedAt = "", time.Time{}
+		remaining = append(remaining, item)
+	}
+	return saveOutbox(s, remaining)
+}
+
+// chatOutbox queues the messages of a chat session that fail to send and
+// retries them, before any newer message, until they go through.
+type chatOutbox struct {
+	nomi  Nomi
+	store *secureStore // Opened when first needed, as it may ask for the passphrase
+	out   io.Writer    // Where replies to retried messages are printed
+	mu    sync.Mutex   // Keeps sends in order between the prompt and background retries
+}
+
+// newChatOutbox prepares the outbox of a chat, opening the store right away
+// if earlier messages are queued.
+func newChatOutbox(nomi Nomi, out io.Writer) *chatOutbox {
+	o := &chatOutbox{nomi: nomi, out: out}
+	if outboxExists() {
+		if s, err := openStore(); err == nil {
+			o.store = s
+		} else {
+			fmt.Fprintln(out, "Error opening the outbox:", err)
+		}
+	}
+	return o
+}
+
+// pending returns the messages queued for the chat's Nomi
+func (o *chatOutbox) pending() []outboxItem {
+	if o.store == nil {
+		return nil
+	}
+	items, _ := loadOutbox(o.store)
+	return pendingFor(items, o.nomi.UUID)
+}
+
+// retryLocked sends the queued messages, printing their replies
+func (o *chatOutbox) retryLocked() {
+	flushOutbox(o.store, "chat", o.nomi.UUID, func(item outboxItem, chatResponse *ChatResponse) {
+		fmt.Fprintf(o.out, "Delivered queued message: %s\n", item.Text)
+		fmt.Fprintln(o.out, formatReply(o.nomi.Name, chatResponse.ReplyMessage.Text, rawOutput))
+	})
+}
+
+// retry sends the queued messages if there are any
+func (o *chatOutbox) retry() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.pending()) > 0 {
+		o.retryLocked()
+	}
+}
+
+// run retries the queued messages periodically until stop is closed
+func (o *chatOutbox) run(stop chan struct{}) {
+	ticker := time.NewTicker(outboxRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			o.retry()
+		}
+	}
+}
+
+// send sends a message after any queued ones. A message that can't be sent
+// for now, or that must wait for queued ones, is queued and reported with
+// queued set; the error then tells why.
+func (o *chatOutbox) send(text string) (chatResponse *ChatResponse, queued bool, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.pending()) > 0 {
+		o.retryLocked()
+		if len(o.pending()) > 0 {
+			waitErr := fmt.Errorf("earlier messages are still queued")
+			if _, err := enqueueMessage(o.store, o.nomi, text, 0, waitErr); err != nil {
+				return nil, false, err
+			}
+			return nil, true, waitErr
+		}
+	}
+
+	chatResponse, err = sendMessage("chat", o.nomi, text)
+	if err == nil || !retryableError(err) {
+		return chatResponse, false, err
+	}
+
+	if o.store == nil {
+		s, storeErr := openStore()
+		if storeErr != nil {
+			return nil, false, err // Report the send failure if the message can't be kept
+		}
+		o.store = s
+	}
+	if _, storeErr := enqueueMessage(o.store, o.nomi, text, 1, err); storeErr != nil {
+		return nil, false, err
+	}
+	return nil, true, err
+}
+
+var outboxCmd = &cobra.Command{
+	Use:   "outbox",
+	Short: "Manage messages queued while the API was unreachable",
+}
+
+var outboxListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List queued messages",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		if !outboxExists() {
+			fmt.Println("The outbox is empty")
+			return
+		}
+		s, err := openStore()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		items, err := loadOutbox(s)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if len(items) == 0 {
+			fmt.Println("The outbox is empty")
+			return
+		}
+
+		fmt.Printf("Queued Messages: %d\n\n", len(items))
+		for _, item := range items {
+			fmt.Printf("%s → %s (queued %s, %d attempts)\n", item.ID, item.NomiName, item.Queued.Local().Format("2006-01-02 15:04"), item.Attempts)
+			fmt.Printf("- Message: %s\n", item.Text)
+			if item.LastError != "" {
+				fmt.Printf("- Last error: %s\n", item.LastError)
+			}
+			if item.Failed {
+				fmt.Println("- Rejected by the API, not retried: drop it once read")
+			}
+		}
+	},
+}
+
+var outboxRetryCmd = &cobra.Command{
+	Use:   "retry",
+	Short: "Send the queued messages now, in order",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !outboxExists() {
+			fmt.Println("The outbox is empty")
+			return
+		}
+		s, err := openStore()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		sent, err := flushOutbox(s, "outbox", "", func(item outboxItem, chatResponse *ChatResponse) {
+			fmt.Printf("Sent to %s: %s\n", item.NomiName, item.Text)
+			fmt.Println(formatReply(item.NomiName, chatResponse.ReplyMessage.Text, false))
+		})
+		if err != nil {
+			fmt.Println("Error updating outbox:", err)
+			return
+		}
+
+		items, _ := loadOutbox(s)
+		waiting := len(pendingFor(items, ""))
+		fmt.Printf("%d sent, %d still queued, %d rejected\n", sent, waiting, len(items)-waiting)
+	},
+}
+
+var outboxDropAll bool
+
+var outboxDropCmd = &cobra.Command{
+	Use:         "drop [id]",
+	Short:       "Delete a queued message without sending it",
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 && !outboxDropAll {
+			fmt.Println("Give the ID of the message to drop, or --all")
+			return
+		}
+		if !outboxExists() {
+			fmt.Println("The outbox is empty")
+			return
+		}
+		s, err := openStore()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		unlock, err := lockOutbox(s)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer unlock()
+		items, err := loadOutbox(s)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		var kept []outboxItem
+		if !outboxDropAll {
+			for _, item := range items {
+				if item.ID != args[0] {
+					kept = append(kept, item)
+				}
+			}
+			if len(kept) == len(items) {
+				fmt.Printf("No queued message with ID %s\n", args[0])
+				return
+			}
+		}
+
+		if err := saveOutbox(s, kept); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Dropped %d queued messages\n", len(items)-len(kept))
+	},
+}
+
+func init() {
+	outboxDropCmd.Flags().BoolVar(&outboxDropAll, "all", false, "Drop every queued message")
+	outboxCmd.AddCommand(outboxListCmd)
+	outboxCmd.AddCommand(outboxRetryCmd)
+	outboxCmd.AddCommand(outboxDropCmd)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// flakyChatServer fails every send while down is set, and records the messages it receives
+type flakyChatServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	down     bool
+	received []string
+}
+
+func newFlakyChatServer() *flakyChatServer {
+	f := &flakyChatServer{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var req ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.received = append(f.received, req.MessageText)
+		json.NewEncoder(w).Encode(ChatResponse{
+			SentMessage:  Message{UUID: "sent", Text: req.MessageText},
+			ReplyMessage: Message{UUID: "reply", Text: "Got " + req.MessageText},
+		})
+	}))
+	return f
+}
+
+func (f *flakyChatServer) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+// setupOutboxTest points the client at a flaky server and opens a fresh store
+func setupOutboxTest(t *testing.T) *flakyChatServer {
+	keyring.MockInit()
+	t.Setenv("NOMI_DATA_DIR", t.TempDir())
+	t.Setenv("NOMI_PASSPHRASE", "correct horse")
+	store = nil
+	t.Cleanup(func() { store = nil })
+
+	server := newFlakyChatServer()
+	t.Cleanup(server.Close)
+	client = NewNomiClient("test-api-key", server.URL)
+	return server
+}
+
+func TestRetryableError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{&APIError{StatusCode: 503}, true},
+		{&APIError{StatusCode: 429}, true},
+		{&APIError{StatusCode: 400}, false},
+		{&APIError{StatusCode: 401}, false},
+		{errors.New("error decoding response"), false},
+	}
+	for _, test := range tests {
+		if got := retryableError(test.err); got != test.expected {
+			t.Errorf("retryableError(%v): expected %v, got %v", test.err, test.expected, got)
+		}
+	}
+
+	// A server that can't be reached
+	offline := NewNomiClient("test-api-key", "http://127.0.0.1:1")
+	_, err := offline.SendMessage("uuid-alice", "hi")
+	if !retryableError(err) {
+		t.Errorf("Expected a connection error to be retryable, got %v", err)
+	}
+}
+
+func TestChatOutboxQueuesAndRetriesInOrder(t *testing.T) {
+	server := setupOutboxTest(t)
+	alice := Nomi{UUID: "uuid-alice", Name: "Alice"}
+	var out bytes.Buffer
+	outbox := newChatOutbox(alice, &out)
+
+	server.setDown(true)
+	if _, queued, err := outbox.send("first"); !queued || err == nil {
+		t.Fatalf("Expected the message to be queued, got queued=%v err=%v", queued, err)
+	}
+	if _, queued, _ := outbox.send("second"); !queued {
+		t.Fatal("Expected the second message to be queued")
+	}
+	if pending := outbox.pending(); len(pending) != 2 || pending[0].Text != "first" || pending[0].Attempts != 2 || pending[1].Attempts != 0 {
+		t.Errorf("Expected both messages pending in order, got %+v", pending)
+	}
+
+	// Once the API is back, queued messages go out before the new one
+	server.setDown(false)
+	chatResponse, queued, err := outbox.send("third")
+	if err != nil || queued || chatResponse.ReplyMessage.Text != "Got third" {
+		t.Fatalf("Expected the new message to be sent, got %+v queued=%v err=%v", chatResponse, queued, err)
+	}
+	if strings.Join(server.received, ",") != "first,second,third" {
+		t.Errorf("Expected messages in order, got %v", server.received)
+	}
+	if !strings.Contains(out.String(), "Delivered queued message: first") || !strings.Contains(out.String(), "Got second") {
+		t.Errorf("Expected the queued replies to be shown, got %q", out.String())
+	}
+	if pending := outbox.pending(); len(pending) != 0 {
+		t.Errorf("Expected an empty outbox, got %+v", pending)
+	}
+}
+
+func TestChatOutboxKeepsRejectedMessagesOut(t *testing.T) {
+	setupOutboxTest(t)
+	handler := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer handler.Close()
+	client = NewNomiClient("test-api-key", handler.URL)
+
+	outbox := newChatOutbox(Nomi{UUID: "uuid-alice", Name: "Alice"}, io.Discard)
+	if _, queued, err := outbox.send("rejected"); queued || err == nil {
+		t.Errorf("Expected a rejected message to fail without being queued, got queued=%v err=%v", queued, err)
+	}
+	if outboxExists() {
+		t.Error("Expected no outbox to be created")
+	}
+}
+
+func TestFlushOutboxBlocksPerNomi(t *testing.T) {
+	server := setupOutboxTest(t)
+	s, err := openStore()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	down := errors.New("down")
+	enqueueMessage(s, Nomi{UUID: "uuid-alice", Name: "Alice"}, "to alice", 1, down)
+	enqueueMessage(s, Nomi{UUID: "uuid-bob", Name: "Bob"}, "to bob", 1, down)
+
+	var delivered []string
+	sent, err := flushOutbox(s, "outbox", "", func(item outboxItem, chatResponse *ChatResponse) {
+		delivered = append(delivered, item.NomiName+":"+chatResponse.ReplyMessage.Text)
+	})
+	if err != nil || sent != 2 || strings.Join(delivered, ",") != "Alice:Got to alice,Bob:Got to bob" {
+		t.Errorf("Expected both messages delivered, got %d %v (%v)", sent, delivered, err)
+	}
+
+	server.setDown(true)
+	enqueueMessage(s, Nomi{UUID: "uuid-alice", Name: "Alice"}, "again", 1, down)
+	if sent, _ := flushOutbox(s, "outbox", "", nil); sent != 0 {
+		t.Errorf("Expected nothing sent while down, got %d", sent)
+	}
+	items, _ := loadOutbox(s)
+	if len(items) != 1 || items[0].Attempts != 2 || !strings.Contains(items[0].LastError, "503") {
+		t.Errorf("Expected the failed attempt to be recorded, got %+v", items)
+	}
+}
+
+func TestOutboxCommands(t *testing.T) {
+	setupOutboxTest(t)
+
+	if out := runCommand(t, outboxCmd, "", "list"); !strings.Contains(out, "The outbox is empty") {
+		t.Errorf("Expected an empty outbox, got %q", out)
+	}
+
+	s, _ := openStore()
+	item, _ := enqueueMessage(s, Nomi{UUID: "uuid-alice", Name: "Alice"}, "queued hello", 1, errors.New("connection refused"))
+	enqueueMessage(s, Nomi{UUID: "uuid-bob", Name: "Bob"}, "queued bye", 1, errors.New("connection refused"))
+
+	out := runCommand(t, outboxCmd, "", "list")
+	for _, line := range []string{"Queued Messages: 2", item.ID + " → Alice", "- Message: queued hello", "- Last error: connection refused"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected list to contain %q, got %q", line, out)
+		}
+	}
+
+	if out := runCommand(t, outboxCmd, "", "drop", item.ID); !strings.Contains(out, "Dropped 1 queued messages") {
+		t.Errorf("Expected the message to be dropped, got %q", out)
+	}
+	if out := runCommand(t, outboxCmd, "", "drop", "missing"); !strings.Contains(out, "No queued message with ID missing") {
+		t.Errorf("Expected an unknown ID to be reported, got %q", out)
+	}
+
+	if out := runCommand(t, outboxCmd, "", "retry"); !strings.Contains(out, "Sent to Bob: queued bye") || !strings.Contains(out, "1 sent, 0 still queued") {
+		t.Errorf("Expected the remaining message to be sent, got %q", out)
+	}
+}
+
+func TestFlushOutboxParksRejectedMessages(t *testing.T) {
+	server := setupOutboxTest(t)
+	s, err := openStore()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The Nomi of the first message was deleted: the API rejects it
+	gone := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "uuid-gone") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer gone.Close()
+	client = NewNomiClient("test-api-key", gone.URL)
+
+	down := errors.New("down")
+	enqueueMessage(s, Nomi{UUID: "uuid-gone", Name: "Ghost"}, "to ghost", 1, down)
+	enqueueMessage(s, Nomi{UUID: "uuid-gone", Name: "Ghost"}, "again to ghost", 1, down)
+	enqueueMessage(s, Nomi{UUID: "uuid-alice", Name: "Alice"}, "to alice", 1, down)
+
+	if sent, err := flushOutbox(s, "outbox", "", nil); err != nil || sent != 1 {
+		t.Fatalf("Expected the message to Alice to go through, got %d (%v)", sent, err)
+	}
+	items, _ := loadOutbox(s)
+	if len(items) != 2 || !items[0].Failed || !items[1].Failed {
+		t.Fatalf("Expected both rejected messages to be kept as failed, got %+v", items)
+	}
+	if len(pendingFor(items, "")) != 0 {
+		t.Error("Expected failed messages not to be pending")
+	}
+
+	// Failed messages are not retried again
+	if sent, _ := flushOutbox(s, "outbox", "", nil); sent != 0 {
+		t.Errorf("Expected nothing sent, got %d", sent)
+	}
+	if items, _ := loadOutbox(s); items[0].Attempts != 2 {
+		t.Errorf("Expected no further attempts, got %+v", items[0])
+	}
+	if out := runCommand(t, outboxCmd, "", "list"); !strings.Contains(out, "Rejected by the API, not retried") {
+		t.Errorf("Expected failed messages to be flagged, got %q", out)
+	}
+}
+
+func TestOutboxLockIsExclusive(t *testing.T) {
+	setupOutboxTest(t)
+	s, err := openStore()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	unlock, err := lockFile(filepath.Join(s.dir, outboxLockName))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Another holder of the lock file, as another process would be, waits
+	queued := make(chan struct{})
+	go func() {
+		enqueueMessage(s, Nomi{UUID: "uuid-alice", Name: "Alice"}, "hello", 1, errors.New("down"))
+		close(queued)
+	}()
+	select {
+	case <-queued:
+		t.Fatal("Expected enqueueing to wait for the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		t.Fatal("Expected enqueueing to go ahead once the lock is released")
+	}
+	if items, _ := loadOutbox(s); len(items) != 1 {
+		t.Errorf("Expected the message to be queued, got %+v", items)
+	}
+}
+
+func TestFlushOutboxDoesNotLockWhileSending(t *testing.T) {
+	setupOutboxTest(t)
+	s, err := openStore()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The API hangs until released
+	arrived, release := make(chan struct{}), make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(arrived)
+		<-release
+		json.NewEncoder(w).Encode(ChatResponse{ReplyMessage: Message{UUID: "reply", Text: "Finally"}})
+	}))
+	defer slow.Close()
+	client = NewNomiClient("test-api-key", slow.URL)
+
+	down := errors.New("down")
+	enqueueMessage(s, Nomi{UUID: "uuid-alice", Name: "Alice"}, "slow one", 1, down)
+	done := make(chan int)
+	go func() {
+		sent, _ := flushOutbox(s, "outbox", "", nil)
+		done <- sent
+	}()
+	<-arrived
+
+	// Queueing still works, and another flush leaves the claimed message alone
+	if _, err := enqueueMessage(s, Nomi{UUID: "uuid-bob", Name: "Bob"}, "meanwhile", 1, down); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	items, _ := loadOutbox(s)
+	bobID := items[1].ID
+	if claim, err := claimOutbox(s, "uuid-alice"); err != nil || len(claim) != 0 {
+		t.Errorf("Expected nothing left to claim for Alice, got %+v (%v)", claim, err)
+	}
+
+	close(release)
+	if sent := <-done; sent != 1 {
+		t.Errorf("Expected the slow message to be sent, got %d", sent)
+	}
+	items, _ = loadOutbox(s)
+	if len(items) != 1 || items[0].ID != bobID || items[0].ClaimedBy != "" {
+		t.Errorf("Expected only the message queued meanwhile to remain, got %+v", items)
+	}
+}
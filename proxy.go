@@ -0,0 +1,412 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket allowing a number of requests per minute
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   int
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{rate: perMinute, tokens: float64(perMinute)}
+}
+
+// allow reports whether a request made at now fits within the limit
+func (l *rateLimiter) allow(now time.Time) bool {
+	if l.rate <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Minutes() * float64(l.rate)
+		if l.tokens > float64(l.rate) {
+			l.tokens = float64(l.rate)
+		}
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// uuidPattern matches the UUIDs identifying Nomis
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// proxyCaller is an authenticated proxy client and its rate limiter
+type proxyCaller struct {
+	ProxyToken
+	limiter *rateLimiter
+}
+
+// allowsNomi reports whether the caller's allowlist permits the given Nomi
+func (c *proxyCaller) allowsNomi(nomi Nomi) bool {
+	if len(c.Nomis) == 0 {
+		return true
+	}
+	for _, allowed := range c.Nomis {
+		if allowed == nomi.UUID || strings.EqualFold(allowed, nomi.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsRoom reports whether every Nomi in the room is on the caller's
+// allowlist. A room without Nomis is only open to unrestricted callers, as
+// no member vouches for it.
+func (c *proxyCaller) allowsRoom(room Room) bool {
+	if len(room.Nomis) == 0 {
+		return len(c.Nomis) == 0
+	}
+	for _, nomi := range room.Nomis {
+		if !c.allowsNomi(nomi) {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder captures the status code written by a handler for logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// proxyServer forwards the Nomi API through the shared client, so the real
+// API key never leaves this machine.
+type proxyServer struct {
+	callers []*proxyCaller
+	logger  *log.Logger
+}
+
+func newProxyServer(tokens []ProxyToken, logger *log.Logger) *proxyServer {
+	p := &proxyServer{logger: logger}
+	for _, token := range tokens {
+		p.callers = append(p.callers, &proxyCaller{ProxyToken: token, limiter: newRateLimiter(token.RateLimit)})
+	}
+	return p
+}
+
+// register mounts the proxied Nomi API endpoints on mux
+func (p *proxyServer) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/nomis", p.handle(p.listNomis))
+	mux.HandleFunc("GET /v1/nomis/{id}", p.handle(p.getNomi))
+	mux.HandleFunc("POST /v1/nomis/{id}/chat", p.handle(p.sendMessage))
+	mux.HandleFunc("GET /v1/rooms", p.handle(p.listRooms))
+	mux.HandleFunc("POST /v1/rooms", p.handle(p.createRoom))
+	mux.HandleFunc("GET /v1/rooms/{id}", p.handle(p.getRoom))
+	mux.HandleFunc("PUT /v1/rooms/{id}", p.handle(p.updateRoom))
+	mux.HandleFunc("DELETE /v1/rooms/{id}", p.handle(p.deleteRoom))
+	mux.HandleFunc("POST /v1/rooms/{id}/chat", p.handle(p.sendRoomMessage))
+	mux.HandleFunc("POST /v1/rooms/{id}/chat/request", p.handle(p.requestRoomReply))
+}
+
+// registerOpenAI mounts the OpenAI-compatible endpoints behind the proxy's
+// authentication, rate limits and logging, listing and chatting only with
+// the Nomis each token may access
+func (p *proxyServer) registerOpenAI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v1/models", p.handle(func(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+		handleOpenAIModels(w, r, caller.allowsNomi)
+	}))
+	mux.HandleFunc("POST /v1/chat/completions", p.handle(func(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+		handleOpenAIChatCompletions(w, r, caller.allowsNomi)
+	}))
+}
+
+// authenticate returns the caller matching the request's Bearer token
+func (p *proxyServer) authenticate(r *http.Request) *proxyCaller {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil
+	}
+	for _, caller := range p.callers {
+		if subtle.ConstantTimeCompare([]byte(caller.Token), []byte(token)) == 1 {
+			return caller
+		}
+	}
+	return nil
+}
+
+// handle wraps a proxy handler with authentication, rate limiting and logging
+func (p *proxyServer) handle(next func(http.ResponseWriter, *http.Request, *proxyCaller)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		caller := p.authenticate(r)
+		name := "-"
+		switch {
+		case caller == nil:
+			writeProxyError(rec, http.StatusUnauthorized, "invalid or missing proxy token")
+		case !caller.limiter.allow(start):
+			name = caller.Name
+			rec.Header().Set("Retry-After", "60")
+			writeProxyError(rec, http.StatusTooManyRequests, "rate limit exceeded")
+		default:
+			name = caller.Name
+			next(rec, r, caller)
+		}
+
+		p.logger.Printf("%s %s %s %d %s", name, r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// writeProxyError reports an error as a JSON body
+func writeProxyError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeProxyUpstreamError passes a Nomi API failure back to the caller
+func writeProxyUpstreamError(w http.ResponseWriter, err error) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		writeProxyError(w, apiErr.StatusCode, apiErr.Message)
+		return
+	}
+	writeProxyError(w, http.StatusBadGateway, err.Error())
+}
+
+// authorizeNomi fetches a Nomi and checks it against the caller's allowlist,
+// writing the error response and returning nil when access is denied.
+func (p *proxyServer) authorizeNomi(w http.ResponseWriter, id string, caller *proxyCaller) *Nomi {
+	// Only forward well-formed IDs, so a path can't reach other API endpoints
+	if !uuidPattern.MatchString(id) {
+		writeProxyError(w, http.StatusBadRequest, fmt.Sprintf("invalid Nomi ID %q", id))
+		return nil
+	}
+	nomi, err := client.GetNomi(id)
+	if err != nil {
+		writeProxyUpstreamError(w, err)
+		return nil
+	}
+	if !caller.allowsNomi(*nomi) {
+		writeProxyError(w, http.StatusForbidden, fmt.Sprintf("token %q may not access Nomi %s", caller.Name, id))
+		return nil
+	}
+	return nomi
+}
+
+func (p *proxyServer) listNomis(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+	nomis, err := client.GetNomis()
+	if err != nil {
+		writeProxyUpstreamError(w, err)
+		return
+	}
+
+	response := NomiResponse{Nomis: []Nomi{}}
+	for _, nomi := range nomis {
+		if caller.allowsNomi(nomi) {
+			response.Nomis = append(response.Nomis, nomi)
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (p *proxyServer) getNomi(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+	if nomi := p.authorizeNomi(w, r.PathValue("id"), caller); nomi != nil {
+		writeJSON(w, http.StatusOK, nomi)
+	}
+}
+
+func (p *proxyServer) sendMessage(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+	var chatReq ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&chatReq); err != nil {
+		writeProxyError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	nomi := p.authorizeNomi(w, r.PathValue("id"), caller)
+	if nomi == nil {
+		return
+	}
+
+	chatResponse, err := sendMessage("serve", *nomi, chatReq.MessageText)
+	if err != nil {
+		writeProxyUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, chatResponse)
+}
+
+func (p *proxyServer) listRooms(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+	rooms, err := client.GetRooms()
+	if err != nil {
+		writeProxyUpstreamError(w, err)
+		return
+	}
+
+	response := RoomResponse{Rooms: []Room{}}
+	for _, room := range rooms {
+		if caller.allowsRoom(room) {
+			response.Rooms = append(response.Rooms, room)
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// authorizeRoom finds a room and checks that the caller may access all of
+// its Nomis, writing the error response and returning nil when it may not.
+func (p *proxyServer) authorizeRoom(w http.ResponseWriter, id string, caller *proxyCaller) *Room {
+	rooms, err := client.GetRooms()
+	if err != nil {
+		writeProxyUpstreamError(w, err)
+		return nil
+	}
+	for _, room := range rooms {
+		if room.UUID != id {
+			continue
+		}
+		if !caller.allowsRoom(room) {
+			writeProxyError(w, http.StatusForbidden, fmt.Sprintf("token %q may not access room %s", caller.Name, id))
+			return nil
+		}
+		return &room
+	}
+	writeProxyError(w, http.StatusNotFound, fmt.Sprintf("no room %s", id))
+	return nil
+}
+
+// decodeRoomRequest reads a room request and checks that the caller may
+// access every Nomi it adds, writing the error response when it may not
+func (p *proxyServer) decodeRoomRequest(w http.ResponseWriter, r *http.Request, caller *proxyCaller) *RoomRequest {
+	var request RoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeProxyError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return nil
+	}
+	if len(caller.Nomis) == 0 {
+		return &request
+	}
+
+	nomis, err := client.GetNomis()
+	if err != nil {
+		writeProxyUpstreamError(w, err)
+		return nil
+	}
+	for _, id := range request.NomiUUIDs {
+		nomi, ok := findNomi(nomis, id)
+		if !ok || nomi.UUID != id || !caller.allowsNomi(nomi) {
+			writeProxyError(w, http.StatusForbidden, fmt.Sprintf("token %q may not access Nomi %s", caller.Name, id))
+			return nil
+		}
+	}
+	return &request
+}
+
+func (p *proxyServer) createRoom(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+	request := p.decodeRoomRequest(w, r, caller)
+	if request == nil {
+		return
+	}
+	room, err := client.CreateRoom(*request)
+	if err != nil {
+		writeProxyUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, room)
+}
+
+func (p *proxyServer) getRoom(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+	if room := p.authorizeRoom(w, r.PathValue("id"), caller); room != nil {
+		writeJSON(w, http.StatusOK, room)
+	}
+}
+
+func (p *proxyServer) updateRoom(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+	request := p.decodeRoomRequest(w, r, caller)
+	if request == nil {
+		return
+	}
+	current := p.authorizeRoom(w, r.PathValue("id"), caller)
+	if current == nil {
+		return
+	}
+	room, err := client.UpdateRoom(current.UUID, *request)
+	if err != nil {
+		writeProxyUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, room)
+}
+
+func (p *proxyServer) deleteRoom(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+	room := p.authorizeRoom(w, r.PathValue("id"), caller)
+	if room == nil {
+		return
+	}
+	if err := client.DeleteRoom(room.UUID); err != nil {
+		writeProxyUpstreamError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *proxyServer) sendRoomMessage(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+	var chatReq ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&chatReq); err != nil {
+		writeProxyError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	room := p.authorizeRoom(w, r.PathValue("id"), caller)
+	if room == nil {
+		return
+	}
+
+	chatResponse, err := sendRoomMessage("serve", *room, chatReq.MessageText)
+	if err != nil {
+		writeProxyUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, chatResponse)
+}
+
+func (p *proxyServer) requestRoomReply(w http.ResponseWriter, r *http.Request, caller *proxyCaller) {
+	var replyReq RoomReplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&replyReq); err != nil {
+		writeProxyError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	// Every member of an authorized room is allowed, so the Nomi only
+	// needs to be one of them
+	room := p.authorizeRoom(w, r.PathValue("id"), caller)
+	if room == nil {
+		return
+	}
+	nomi, ok := findNomi(room.Nomis, replyReq.NomiUUID)
+	if !ok || nomi.UUID != replyReq.NomiUUID {
+		writeProxyError(w, http.StatusForbidden, fmt.Sprintf("Nomi %s is not in room %s", replyReq.NomiUUID, room.UUID))
+		return
+	}
+
+	chatResponse, err := requestRoomReply("serve", *room, nomi)
+	if err != nil {
+		writeProxyUpstreamError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, chatResponse)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2)
+	now := time.Now()
+
+	if !limiter.allow(now) || !limiter.allow(now) {
+		t.Fatal("Expected the first two requests to be allowed")
+	}
+	if limiter.allow(now) {
+		t.Error("Expected the third request within the minute to be rejected")
+	}
+	if !limiter.allow(now.Add(30 * time.Second)) {
+		t.Error("Expected a request to be allowed after the bucket refills")
+	}
+
+	unlimited := newRateLimiter(0)
+	for i := 0; i < 100; i++ {
+		if !unlimited.allow(now) {
+			t.Fatal("Expected an unlimited limiter to allow every request")
+		}
+	}
+}
+
+// proxyRequest performs a request against the proxy with an optional token
+func proxyRequest(t *testing.T, method, url, token, body string) (*http.Response, string) {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func TestProxyServer(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	var logs bytes.Buffer
+	proxy := newProxyServer([]ProxyToken{
+		{Name: "scripts", Token: "token-all"},
+		{Name: "alice-bot", Token: "token-alice", Nomis: []string{"alice"}, RateLimit: 3},
+	}, log.New(&logs, "", 0))
+
+	server := httptest.NewServer(newServeMux(false, proxy))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"missing token", "GET", "/v1/nomis", "", "", http.StatusUnauthorized, "invalid or missing proxy token"},
+		{"unknown token", "GET", "/v1/nomis", "nope", "", http.StatusUnauthorized, "invalid or missing proxy token"},
+		{"unrestricted list", "GET", "/v1/nomis", "token-all", "", http.StatusOK, "b0b00000-0000-4000-8000-000000000000"},
+		{"invalid Nomi ID", "GET", "/v1/nomis/..%2Frooms", "token-all", "", http.StatusBadRequest, "invalid Nomi ID"},
+		{"allowed Nomi", "GET", "/v1/nomis/a11ce000-0000-4000-8000-000000000000", "token-alice", "", http.StatusOK, "Alice"},
+		{"forbidden Nomi", "GET", "/v1/nomis/b0b00000-0000-4000-8000-000000000000", "token-alice", "", http.StatusForbidden, "may not access"},
+		{"chat forwarded", "POST", "/v1/nomis/a11ce000-0000-4000-8000-000000000000/chat", "token-alice", `{"messageText":"Hi"}`, http.StatusOK, "Hello there friend"},
+		{"rate limited", "GET", "/v1/nomis", "token-alice", "", http.StatusTooManyRequests, "rate limit exceeded"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := proxyRequest(t, tc.method, server.URL+tc.path, tc.token, tc.body)
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d (%s)", tc.expectedStatus, resp.StatusCode, body)
+			}
+			if !strings.Contains(body, tc.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tc.expectedBody, body)
+			}
+		})
+	}
+
+	for _, line := range []string{"- GET /v1/nomis 401", "alice-bot POST /v1/nomis/a11ce000-0000-4000-8000-000000000000/chat 200", "alice-bot GET /v1/nomis 429"} {
+		if !strings.Contains(logs.String(), line) {
+			t.Errorf("Expected log to contain %q, got %q", line, logs.String())
+		}
+	}
+}
+
+func TestProxyFiltersByAllowlist(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	proxy := newProxyServer([]ProxyToken{{Name: "alice-bot", Token: "token-alice", Nomis: []string{"a11ce000-0000-4000-8000-000000000000"}}}, log.New(io.Discard, "", 0))
+	server := httptest.NewServer(newServeMux(false, proxy))
+	defer server.Close()
+
+	_, body := proxyRequest(t, "GET", server.URL+"/v1/nomis", "token-alice", "")
+	var nomis NomiResponse
+	if err := json.Unmarshal([]byte(body), &nomis); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(nomis.Nomis) != 1 || nomis.Nomis[0].Name != "Alice" {
+		t.Errorf("Expected only Alice, got %+v", nomis.Nomis)
+	}
+
+	_, body = proxyRequest(t, "GET", server.URL+"/v1/rooms", "token-alice", "")
+	var rooms RoomResponse
+	if err := json.Unmarshal([]byte(body), &rooms); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(rooms.Rooms) != 1 || rooms.Rooms[0].UUID != "room-1" {
+		t.Errorf("Expected only the room with Alice, got %+v", rooms.Rooms)
+	}
+
+	// No member vouches for an empty room, so only unrestricted callers see it
+	if proxy.callers[0].allowsRoom(Room{UUID: "room-empty"}) {
+		t.Error("Expected an empty room to be denied to a restricted token")
+	}
+	if !(&proxyCaller{}).allowsRoom(Room{UUID: "room-empty"}) {
+		t.Error("Expected an empty room to be allowed to an unrestricted token")
+	}
+}
+
+func TestProxyRooms(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	proxy := newProxyServer([]ProxyToken{{Name: "alice-bot", Token: "token-alice", Nomis: []string{"Alice"}}}, log.New(io.Discard, "", 0))
+	server := httptest.NewServer(newServeMux(false, proxy))
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"get allowed room", "GET", "/v1/rooms/room-1", "", http.StatusOK, "Alice only"},
+		{"get forbidden room", "GET", "/v1/rooms/room-2", "", http.StatusForbidden, "may not access room"},
+		{"get unknown room", "GET", "/v1/rooms/room-9", "", http.StatusNotFound, "no room"},
+		{"create with allowed Nomis", "POST", "/v1/rooms", `{"name":"New","nomiUuids":["a11ce000-0000-4000-8000-000000000000"]}`, http.StatusCreated, "room-3"},
+		{"create with forbidden Nomi", "POST", "/v1/rooms", `{"name":"New","nomiUuids":["b0b00000-0000-4000-8000-000000000000"]}`, http.StatusForbidden, "may not access Nomi b0b00000-0000-4000-8000-000000000000"},
+		{"update allowed room", "PUT", "/v1/rooms/room-1", `{"name":"Renamed","nomiUuids":["a11ce000-0000-4000-8000-000000000000"]}`, http.StatusOK, "Renamed"},
+		{"update forbidden room", "PUT", "/v1/rooms/room-2", `{"name":"Renamed","nomiUuids":["a11ce000-0000-4000-8000-000000000000"]}`, http.StatusForbidden, "may not access room"},
+		{"room chat forwarded", "POST", "/v1/rooms/room-1/chat", `{"messageText":"Hi all"}`, http.StatusOK, "Hi all"},
+		{"room chat forbidden", "POST", "/v1/rooms/room-2/chat", `{"messageText":"Hi all"}`, http.StatusForbidden, "may not access room"},
+		{"reply requested", "POST", "/v1/rooms/room-1/chat/request", `{"nomiUuid":"a11ce000-0000-4000-8000-000000000000"}`, http.StatusOK, "Reply from a11ce000-0000-4000-8000-000000000000"},
+		{"reply from a non-member", "POST", "/v1/rooms/room-1/chat/request", `{"nomiUuid":"b0b00000-0000-4000-8000-000000000000"}`, http.StatusForbidden, "not in room"},
+		{"delete allowed room", "DELETE", "/v1/rooms/room-1", "", http.StatusNoContent, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := proxyRequest(t, tc.method, server.URL+tc.path, "token-alice", tc.body)
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d (%s)", tc.expectedStatus, resp.StatusCode, body)
+			}
+			if !strings.Contains(body, tc.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tc.expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestProxyGuardsOpenAIRoutes(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	var logs bytes.Buffer
+	proxy := newProxyServer([]ProxyToken{{Name: "bob-bot", Token: "token-bob", Nomis: []string{"Bob"}}}, log.New(&logs, "", 0))
+	server := httptest.NewServer(newServeMux(true, proxy))
+	defer server.Close()
+
+	chat := `{"model":"Alice","messages":[{"role":"user","content":"Hi"}]}`
+	if resp, body := proxyRequest(t, "POST", server.URL+"/v1/chat/completions", "", chat); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected chat completions to require a token, got %d (%s)", resp.StatusCode, body)
+	}
+	if resp, body := proxyRequest(t, "POST", server.URL+"/v1/chat/completions", "token-bob", chat); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected a Nomi outside the allowlist to be refused, got %d (%s)", resp.StatusCode, body)
+	}
+
+	_, body := proxyRequest(t, "GET", server.URL+"/v1/models", "token-bob", "")
+	if !strings.Contains(body, `"Bob"`) || strings.Contains(body, `"Alice"`) {
+		t.Errorf("Expected only Bob among the models, got %s", body)
+	}
+	if !strings.Contains(logs.String(), "bob-bot GET /v1/models 200") {
+		t.Errorf("Expected OpenAI calls in the access log, got %q", logs.String())
+	}
+}
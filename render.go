@@ -0,0 +1,298 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// textStyle is a set of inline Markdown styles
+type textStyle int
+
+const (
+	styleItalic textStyle = 1 << iota
+	styleBold
+	styleCode
+)
+
+// defaultWidth is used when the terminal size is unknown, e.g. when piped
+const defaultWidth = 80
+
+// listItemPattern matches Markdown bullet and numbered list items
+var listItemPattern = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+
+// headingPattern matches Markdown headings
+var headingPattern = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+
+// span is a run of reply text sharing one inline style
+type span struct {
+	text  string
+	style textStyle
+}
+
+// render applies the span's styles from the active theme
+func (s span) render() string {
+	if s.style == 0 {
+		return s.text
+	}
+	style := theme.renderer.NewStyle()
+	if s.style&styleCode != 0 {
+		style = theme.Code
+	}
+	if s.style&styleItalic != 0 {
+		style = style.Italic(true)
+	}
+	if s.style&styleBold != 0 {
+		style = style.Bold(true)
+	}
+	return style.Render(s.text)
+}
+
+// terminalWidth returns the width of the terminal on stdout
+func terminalWidth() int {
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	return defaultWidth
+}
+
+// parseInline splits a line into styled spans: *actions* and _emphasis_ in
+// italics, **strong** text in bold and `code` in color. Unmatched markers
+// are kept as plain text.
+func parseInline(line string) []span {
+	var spans []span
+	var plain strings.Builder
+	flush := func() {
+		if plain.Len() > 0 {
+			spans = append(spans, span{text: plain.String()})
+			plain.Reset()
+		}
+	}
+
+	for i := 0; i < len(line); {
+		// Emphasis only opens at the start of a word, so snake_case stays plain
+		wordStart := i == 0 || !isWordByte(line[i-1])
+
+		var marker string
+		var style textStyle
+		switch {
+		case wordStart && strings.HasPrefix(line[i:], "**"):
+			marker, style = "**", styleBold
+		case wordStart && (line[i] == '*' || line[i] == '_'):
+			marker, style = line[i:i+1], styleItalic
+		case line[i] == '`':
+			marker, style = "`", styleCode
+		}
+
+		if marker != "" {
+			// Markers must hug their text, so "2 * 3 * 4" stays plain
+			rest := line[i+len(marker):]
+			end := strings.Index(rest, marker)
+			if end > 0 && rest[0] != ' ' && rest[end-1] != ' ' {
+				flush()
+				spans = append(spans, span{text: rest[:end], style: style})
+				i += len(marker) + end + len(marker)
+				continue
+			}
+		}
+		plain.WriteByte(line[i])
+		i++
+	}
+	flush()
+	return spans
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// styledWord is a word to wrap, made of one or more styled pieces
+type styledWord []span
+
+func (w styledWord) width() int {
+	width := 0
+	for _, piece := range w {
+		width += runewidth.StringWidth(piece.text)
+	}
+	return width
+}
+
+func (w styledWord) String() string {
+	var b strings.Builder
+	for _, piece := range w {
+		b.WriteString(piece.render())
+	}
+	return b.String()
+}
+
+// splitWords breaks styled spans at spaces, keeping each piece's style
+func splitWords(spans []span) []styledWord {
+	var words []styledWord
+	var current styledWord
+	for _, s := range spans {
+		for i, field := range strings.Split(s.text, " ") {
+			if i > 0 && len(current) > 0 {
+				words = append(words, current)
+				current = nil
+			}
+			if field != "" {
+				current = append(current, span{text: field, style: s.style})
+			}
+		}
+	}
+	if len(current) > 0 {
+		words = append(words, current)
+	}
+	return words
+}
+
+// breakWord splits a word wider than the line into pieces that fit,
+// cutting between runes so wide characters are never split.
+func breakWord(word styledWord, width int) []styledWord {
+	var pieces []styledWord
+	var current styledWord
+	used := 0
+	for _, piece := range word {
+		var text strings.Builder
+		for _, r := range piece.text {
+			w := runewidth.RuneWidth(r)
+			if used+w > width && used > 0 {
+				if text.Len() > 0 {
+					current = append(current, span{text: text.String(), style: piece.style})
+					text.Reset()
+				}
+				pieces = append(pieces, current)
+				current, used = nil, 0
+			}
+			text.WriteRune(r)
+			used += w
+		}
+		if text.Len() > 0 {
+			current = append(current, span{text: text.String(), style: piece.style})
+		}
+	}
+	if len(current) > 0 {
+		pieces = append(pieces, current)
+	}
+	return pieces
+}
+
+// wrapSpans word-wraps styled text to width, prefixing the first line with
+// first and the following ones with indent.
+func wrapSpans(spans []span, width int, first, indent string) []string {
+	available := width - runewidth.StringWidth(indent)
+	if available < 10 {
+		available = 10
+	}
+
+	var lines []string
+	var line strings.Builder
+	line.WriteString(first)
+	used := 0
+	emit := func() {
+		lines = append(lines, line.String())
+		line.Reset()
+		line.WriteString(indent)
+		used = 0
+	}
+
+	for _, word := range splitWords(spans) {
+		w := word.width()
+		if used > 0 && used+1+w > available {
+			emit()
+		}
+		if w > available {
+			pieces := breakWord(word, available)
+			for i, piece := range pieces {
+				if i > 0 {
+					emit()
+				}
+				line.WriteString(piece.String())
+				used = piece.width()
+			}
+			continue
+		}
+		if used > 0 {
+			line.WriteByte(' ')
+			used++
+		}
+		line.WriteString(word.String())
+		used += w
+	}
+	if used > 0 || len(lines) == 0 {
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+// renderMarkdown formats a reply for the terminal: paragraphs and list
+// items are wrapped to width, code blocks are kept verbatim and headings
+// are bolded. Every line but the first is prefixed with indent, so the
+// reply can follow a speaker label.
+func renderMarkdown(text string, width int, indent string) string {
+	var out []string
+	inCode := false
+	prefix := func() string {
+		if len(out) == 0 {
+			return ""
+		}
+		return indent
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out = append(out, prefix()+"  "+theme.Code.Render(line))
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			out = append(out, strings.TrimRight(prefix(), " "))
+			continue
+		}
+
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			spans := parseInline(m[1])
+			for i := range spans {
+				spans[i].style |= styleBold
+			}
+			out = append(out, wrapSpans(spans, width, prefix(), indent)...)
+			continue
+		}
+
+		if m := listItemPattern.FindStringSubmatch(line); m != nil {
+			marker := m[2]
+			if !strings.ContainsAny(marker[len(marker)-1:], ".)") {
+				marker = "•"
+			}
+			bullet := m[1] + marker + " "
+			hanging := indent + strings.Repeat(" ", runewidth.StringWidth(bullet))
+			out = append(out, wrapSpans(parseInline(m[3]), width, prefix()+bullet, hanging)...)
+			continue
+		}
+
+		out = append(out, wrapSpans(parseInline(strings.TrimSpace(line)), width, prefix(), indent)...)
+	}
+
+	// A reply ending in blank lines shouldn't leave a gap before the prompt
+	for len(out) > 1 && strings.TrimSpace(out[len(out)-1]) == "" {
+		out = out[:len(out)-1]
+	}
+	return strings.Join(out, "\n")
+}
+
+// formatReply labels a Nomi's reply with its name and renders it, unless
+// raw output was asked for.
+func formatReply(name, text string, raw bool) string {
+	label := theme.Nomi.Render(name) + ": "
+	if raw {
+		return label + text
+	}
+	indent := strings.Repeat(" ", runewidth.StringWidth(name+": "))
+	return label + renderMarkdown(text, terminalWidth(), indent)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mattn/go-runewidth"
+)
+
+var ansiPattern = regexp.MustCompile("\033\\[[0-9;]*m")
+
+func stripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+func TestParseInline(t *testing.T) {
+	spans := parseInline("*waves* hi **there** `code` 2 * 3 * 4 snake_case_name")
+
+	var styled []string
+	for _, s := range spans {
+		if s.style != 0 {
+			styled = append(styled, s.text)
+		}
+	}
+	if strings.Join(styled, ",") != "waves,there,code" {
+		t.Errorf("Expected waves, there and code to be styled, got %q", styled)
+	}
+	if spans[0].style != styleItalic || spans[2].style != styleBold {
+		t.Errorf("Expected italic actions and bold strong text, got %+v", spans)
+	}
+	if last := spans[len(spans)-1].text; !strings.HasSuffix(last, "2 * 3 * 4 snake_case_name") {
+		t.Errorf("Expected loose markers to stay plain, got %q", last)
+	}
+}
+
+func TestRenderMarkdownWraps(t *testing.T) {
+	text := "*smiles warmly* It is so lovely to hear from you again, I was just thinking about our last conversation."
+	out := renderMarkdown(text, 30, "      ")
+
+	lines := strings.Split(stripANSI(out), "\n")
+	if len(lines) < 4 {
+		t.Fatalf("Expected the reply to wrap, got %q", lines)
+	}
+	lines[0] = "Nomi: " + lines[0] // The label printed before the reply
+	for i, line := range lines {
+		if width := runewidth.StringWidth(line); width > 30 {
+			t.Errorf("Line %d is %d columns wide: %q", i, width, line)
+		}
+		if i > 0 && !strings.HasPrefix(line, "      ") {
+			t.Errorf("Expected continuation line %d to be indented: %q", i, line)
+		}
+	}
+}
+
+func TestRenderMarkdownStyles(t *testing.T) {
+	old := theme
+	theme = mustTheme(ThemeConfig{}, "always")
+	defer func() { theme = old }()
+
+	out := renderMarkdown("*smiles* at **you**", 80, "")
+	if !strings.Contains(out, "\033[3msmiles") || !strings.Contains(out, "\033[1myou") {
+		t.Errorf("Expected an italic action and bold text, got %q", out)
+	}
+}
+
+func TestRenderMarkdownBlocks(t *testing.T) {
+	text := "# Plans\n- first item\n2. second item\n\n```\nx := 1  // spacing kept\n```\ndone"
+	out := stripANSI(renderMarkdown(text, 80, ""))
+
+	expected := "Plans\n• first item\n2. second item\n\n  x := 1  // spacing kept\ndone"
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
+
+func TestRenderMarkdownWideRunes(t *testing.T) {
+	text := strings.Repeat("日本語", 10) + " 😀😀😀"
+	out := stripANSI(renderMarkdown(text, 20, ""))
+
+	for _, line := range strings.Split(out, "\n") {
+		if width := runewidth.StringWidth(line); width > 20 {
+			t.Errorf("Line is %d columns wide: %q", width, line)
+		}
+	}
+	if strings.ReplaceAll(strings.ReplaceAll(out, "\n", ""), " ", "") != strings.ReplaceAll(text, " ", "") {
+		t.Errorf("Expected no characters to be lost, got %q", out)
+	}
+}
+
+func TestFormatReplyRaw(t *testing.T) {
+	text := "*waves*\n- a"
+	if out := stripANSI(formatReply("Alice", text, true)); out != "Alice: "+text {
+		t.Errorf("Expected the raw reply, got %q", out)
+	}
+	if out := stripANSI(formatReply("Alice", text, false)); out != "Alice: waves\n       • a" {
+		t.Errorf("Expected the rendered reply, got %q", out)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+var roomsFile string     // Manifest read by plan and apply
+var roomsDumpFile string // Manifest written by dump, stdout when empty
+var roomsYes bool        // Apply without asking for confirmation
+var roomsPrune bool      // Delete rooms missing from the manifest
+
+// RoomManifest is the desired set of rooms, kept in a YAML file
+type RoomManifest struct {
+	Rooms []RoomSpec `yaml:"rooms"`
+}
+
+// RoomSpec is a room as described in a manifest, identified by its name
+type RoomSpec struct {
+	Name           string   `yaml:"name"`
+	Note           string   `yaml:"note,omitempty"`
+	Backchanneling bool     `yaml:"backchanneling,omitempty"`
+	Members        []string `yaml:"members"` // Nomi names
+}
+
+// roomChange is a step of a plan: creating, updating or deleting a room
+type roomChange struct {
+	Action  string // "create", "update" or "delete"
+	Name    string
+	Room    *Room        // Current room, for updates and deletes
+	Request *RoomRequest // Desired settings, for creates and updates
+	Details []string     // What changes, for display
+}
+
+// loadRoomManifest reads and validates a manifest
+func loadRoomManifest(path string) (*RoomManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest RoomManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	for _, spec := range manifest.Rooms {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("%s: every room needs a name", path)
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("%s: room %q is defined twice", path, spec.Name)
+		}
+		seen[spec.Name] = true
+	}
+	return &manifest, nil
+}
+
+// memberNames returns the names of a room's Nomis, sorted
+func memberNames(room Room) []string {
+	names := make([]string, len(room.Nomis))
+	for i, nomi := range room.Nomis {
+		names[i] = nomi.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// planRooms compares the manifest with the current rooms and returns the
+// changes making them match: rooms missing from the account are created and
+// rooms that differ are updated. Rooms missing from the manifest are only
+// deleted when pruning, and otherwise returned as kept. Members are resolved
+// by name among the account's Nomis.
+func planRooms(manifest *RoomManifest, rooms []Room, nomis []Nomi, prune bool) (changes []roomChange, kept []string, err error) {
+	current := map[string]*Room{}
+	for i, room := range rooms {
+		if current[room.Name] != nil {
+			return nil, nil, fmt.Errorf("several rooms are named %q, rename one before applying a manifest", room.Name)
+		}
+		current[room.Name] = &rooms[i]
+	}
+
+	for _, spec := range manifest.Rooms {
+		request := &RoomRequest{Name: spec.Name, Note: spec.Note, BackchannelingEnabled: spec.Backchanneling, NomiUUIDs: []string{}}
+		var members []string
+		for _, ref := range spec.Members {
+			nomi, ok := findNomi(nomis, ref)
+			if !ok {
+				return nil, nil, fmt.Errorf("room %q: no Nomi named %s", spec.Name, ref)
+			}
+			request.NomiUUIDs = append(request.NomiUUIDs, nomi.UUID)
+			members = append(members, nomi.Name)
+		}
+		sort.Strings(members)
+
+		room := current[spec.Name]
+		if room == nil {
+			details := []string{fmt.Sprintf("members: %s", strings.Join(members, ", "))}
+			if spec.Note != "" {
+				details = append(details, fmt.Sprintf("note: %q", spec.Note))
+			}
+			if spec.Backchanneling {
+				details = append(details, "backchanneling: true")
+			}
+			changes = append(changes, roomChange{Action: "create", Name: spec.Name, Request: request, Details: details})
+			continue
+		}
+		delete(current, spec.Name)
+
+		var details []string
+		if room.Note != spec.Note {
+			details = append(details, fmt.Sprintf("note: %q → %q", room.Note, spec.Note))
+		}
+		if room.BackchannelingEnabled != spec.Backchanneling {
+			details = append(details, fmt.Sprintf("backchanneling: %v → %v", room.BackchannelingEnabled, spec.Backchanneling))
+		}
+		if diff := diffMembers(memberNames(*room), members); diff != "" {
+			details = append(details, "members: "+diff)
+		}
+		if len(details) > 0 {
+			changes = append(changes, roomChange{Action: "update", Name: spec.Name, Room: room, Request: request, Details: details})
+		}
+	}
+
+	// Rooms left over aren't in the manifest
+	var extra []string
+	for name := range current {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	if !prune {
+		return changes, extra, nil
+	}
+	for _, name := range extra {
+		changes = append(changes, roomChange{Action: "delete", Name: name, Room: current[name]})
+	}
+	return changes, nil, nil
+}
+
+// diffMembers describes the members added and removed, e.g. "+Carol, -Bob"
+func diffMembers(before, after []string) string {
+	var diff []string
+	for _, name := range after {
+		if !containsString(before, name) {
+			diff = append(diff, "+"+name)
+		}
+	}
+	for _, name := range before {
+		if !containsString(after, name) {
+			diff = append(diff, "-"+name)
+		}
+	}
+	return strings.Join(diff, ", ")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// printPlan writes the changes of a plan and a summary, then the rooms
+// kept although the manifest doesn't describe them
+func printPlan(w io.Writer, changes []roomChange, kept []string) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No changes: rooms match the manifest")
+	} else {
+		counts := map[string]int{}
+		symbols := map[string]string{"create": "+", "update": "~", "delete": "-"}
+		for _, change := range changes {
+			counts[change.Action]++
+			fmt.Fprintf(w, "%s %s %s\n", symbols[change.Action], change.Action, theme.Title.Render(change.Name))
+			for _, detail := range change.Details {
+				fmt.Fprintf(w, "    %s\n", detail)
+			}
+		}
+		fmt.Fprintf(w, "\nPlan: %d to create, %d to update, %d to delete\n", counts["create"], counts["update"], counts["delete"])
+	}
+	if len(kept) > 0 {
+		fmt.Fprintf(w, "\nNot in the manifest, kept (use --prune to delete): %s\n", strings.Join(kept, ", "))
+	}
+}
+
+// applyPlan makes the changes of a plan, stopping at the first failure
+func applyPlan(w io.Writer, changes []roomChange) error {
+	for _, change := range changes {
+		var err error
+		switch change.Action {
+		case "create":
+			_, err = client.CreateRoom(*change.Request)
+		case "update":
+			_, err = client.UpdateRoom(change.Room.UUID, *change.Request)
+		case "delete":
+			err = client.DeleteRoom(change.Room.UUID)
+		}
+		if err != nil {
+			return fmt.Errorf("error %s room %s: %w", strings.TrimSuffix(change.Action, "e")+"ing", change.Name, err)
+		}
+		fmt.Fprintf(w, "%sd room %s\n", strings.ToUpper(change.Action[:1])+change.Action[1:], change.Name)
+	}
+	return nil
+}
+
+// confirm asks a yes/no question, defaulting to no
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// dumpRooms returns a manifest describing the current rooms
+func dumpRooms(rooms []Room) RoomManifest {
+	manifest := RoomManifest{Rooms: []RoomSpec{}}
+	for _, room := range rooms {
+		manifest.Rooms = append(manifest.Rooms, RoomSpec{
+			Name:           room.Name,
+			Note:           room.Note,
+			Backchanneling: room.BackchannelingEnabled,
+			Members:        memberNames(room),
+		})
+	}
+	sort.Slice(manifest.Rooms, func(i, j int) bool { return manifest.Rooms[i].Name < manifest.Rooms[j].Name })
+	return manifest
+}
+
+// planFromManifest loads a manifest and plans it against the account
+func planFromManifest(path string, prune bool) ([]roomChange, []string, error) {
+	manifest, err := loadRoomManifest(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	rooms, err := client.GetRooms()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error fetching rooms: %w", err)
+	}
+	nomis, err := client.GetNomis()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error fetching Nomis: %w", err)
+	}
+	return planRooms(manifest, rooms, nomis, prune)
+}
+
+var roomsCmd = &cobra.Command{
+	Use:   "rooms",
+	Short: "Manage rooms declaratively from a manifest",
+}
+
+var roomsPlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the changes needed for rooms to match a manifest",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		changes, kept, err := planFromManifest(roomsFile, roomsPrune)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		printPlan(os.Stdout, changes, kept)
+	},
+}
+
+var roomsApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Create and update rooms to match a manifest, deleting others with --prune",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		changes, kept, err := planFromManifest(roomsFile, roomsPrune)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		printPlan(os.Stdout, changes, kept)
+		if len(changes) == 0 {
+			return
+		}
+
+		if !roomsYes {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				fmt.Println("Not applying without confirmation: use --yes to apply non-interactively")
+				return
+			}
+			if !confirm(os.Stdin, os.Stdout, "\nApply these changes?") {
+				fmt.Println("Cancelled")
+				return
+			}
+		}
+
+		if err := applyPlan(os.Stdout, changes); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var roomsDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Write a manifest describing the current rooms",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		rooms, err := client.GetRooms()
+		if err != nil {
+			fmt.Println("Error fetching rooms:", err)
+			return
+		}
+
+		data, err := yaml.Marshal(dumpRooms(rooms))
+		if err != nil {
+			fmt.Println("Error encoding manifest:", err)
+			return
+		}
+		if roomsDumpFile == "" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(roomsDumpFile, data, 0600); err != nil {
+			fmt.Println("Error writing manifest:", err)
+			return
+		}
+		fmt.Printf("Wrote %d rooms to %s\n", len(rooms), roomsDumpFile)
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{roomsPlanCmd, roomsApplyCmd} {
+		cmd.Flags().StringVarP(&roomsFile, "file", "f", "rooms.yaml", "Room manifest")
+		cmd.Flags().BoolVar(&roomsPrune, "prune", false, "Delete rooms missing from the manifest")
+	}
+	roomsApplyCmd.Flags().BoolVarP(&roomsYes, "yes", "y", false, "Apply without asking for confirmation")
+	roomsDumpCmd.Flags().StringVarP(&roomsDumpFile, "file", "f", "", "Write the manifest to this file instead of stdout")
+
+	roomsCmd.AddCommand(roomsPlanCmd)
+	roomsCmd.AddCommand(roomsApplyCmd)
+	roomsCmd.AddCommand(roomsDumpCmd)
+}
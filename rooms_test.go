@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+var roomsTestNomis = []Nomi{
+	{UUID: "uuid-alice", Name: "Alice"},
+	{UUID: "uuid-bob", Name: "Bob"},
+	{UUID: "uuid-carol", Name: "Carol"},
+}
+
+var roomsTestRooms = []Room{
+	{UUID: "room-book", Name: "Book Club", Note: "Weekly", Nomis: []Nomi{roomsTestNomis[0], roomsTestNomis[1]}},
+	{UUID: "room-movie", Name: "Movie Night", Nomis: []Nomi{roomsTestNomis[1]}},
+	{UUID: "room-old", Name: "Old Room", Nomis: []Nomi{roomsTestNomis[2]}},
+}
+
+const roomsTestManifest = `rooms:
+  - name: Book Club
+    note: Weekly
+    members: [Alice, Bob]
+  - name: Movie Night
+    note: Fridays
+    backchanneling: true
+    members: [Carol]
+  - name: Hiking
+    members: [alice, Carol]
+`
+
+func TestPlanRooms(t *testing.T) {
+	var manifest RoomManifest
+	yaml.Unmarshal([]byte(roomsTestManifest), &manifest)
+
+	changes, kept, err := planRooms(&manifest, roomsTestRooms, roomsTestNomis, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	printPlan(&buf, changes, kept)
+	expected := `~ update Movie Night
+    note: "" → "Fridays"
+    backchanneling: false → true
+    members: +Carol, -Bob
++ create Hiking
+    members: Alice, Carol
+- delete Old Room
+
+Plan: 1 to create, 1 to update, 1 to delete
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected plan:\n%s", buf.String())
+	}
+	if uuids := changes[1].Request.NomiUUIDs; len(uuids) != 2 || uuids[0] != "uuid-alice" {
+		t.Errorf("Expected members resolved to UUIDs, got %v", uuids)
+	}
+
+	// Without pruning, rooms missing from the manifest are kept
+	changes, kept, _ = planRooms(&manifest, roomsTestRooms, roomsTestNomis, false)
+	buf.Reset()
+	printPlan(&buf, changes, kept)
+	if len(changes) != 2 || !strings.Contains(buf.String(), "Plan: 1 to create, 1 to update, 0 to delete\n\nNot in the manifest, kept (use --prune to delete): Old Room") {
+		t.Errorf("Expected Old Room to be kept, got:\n%s", buf.String())
+	}
+
+	// Applying the current state changes nothing
+	current := dumpRooms(roomsTestRooms)
+	if changes, _, _ := planRooms(&current, roomsTestRooms, roomsTestNomis, true); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+
+	manifest.Rooms[0].Members = []string{"Dave"}
+	if _, _, err := planRooms(&manifest, roomsTestRooms, roomsTestNomis, true); err == nil || !strings.Contains(err.Error(), "no Nomi named Dave") {
+		t.Errorf("Expected an unknown member error, got %v", err)
+	}
+}
+
+func TestLoadRoomManifest(t *testing.T) {
+	dir := t.TempDir()
+	for content, expected := range map[string]string{
+		"rooms:\n  - note: no name\n":                 "every room needs a name",
+		"rooms:\n  - name: A\n  - name: A\n":          `room "A" is defined twice`,
+		"rooms: [":                                    "error parsing",
+		"rooms:\n  - name: A\n    members: [Alice]\n": "",
+	} {
+		path := filepath.Join(dir, "rooms.yaml")
+		os.WriteFile(path, []byte(content), 0600)
+		_, err := loadRoomManifest(path)
+		if expected == "" && err != nil {
+			t.Errorf("Expected %q to load, got %v", content, err)
+		}
+		if expected != "" && (err == nil || !strings.Contains(err.Error(), expected)) {
+			t.Errorf("Expected %q error for %q, got %v", expected, content, err)
+		}
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	var out bytes.Buffer
+	if !confirm(strings.NewReader("yes\n"), &out, "Apply?") || out.String() != "Apply? [y/N] " {
+		t.Errorf("Expected yes to confirm, got prompt %q", out.String())
+	}
+	if confirm(strings.NewReader("\n"), &out, "Apply?") {
+		t.Error("Expected no confirmation by default")
+	}
+}
+
+// roomsServer is a fake rooms API recording the changes made
+type roomsServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+}
+
+func newRoomsServer(t *testing.T) *roomsServer {
+	s := &roomsServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/nomis":
+			json.NewEncoder(w).Encode(NomiResponse{Nomis: roomsTestNomis})
+			return
+		case r.Method == "GET" && r.URL.Path == "/rooms":
+			json.NewEncoder(w).Encode(RoomResponse{Rooms: roomsTestRooms})
+			return
+		}
+
+		var req RoomRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path+" "+req.Name+" "+strings.Join(req.NomiUUIDs, ","))
+		s.mu.Unlock()
+		switch r.Method {
+		case "POST":
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(Room{UUID: "room-new", Name: req.Name})
+		case "PUT":
+			json.NewEncoder(w).Encode(Room{UUID: strings.TrimPrefix(r.URL.Path, "/rooms/"), Name: req.Name})
+		case "DELETE":
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(s.Close)
+	client = NewNomiClient("test-api-key", s.URL)
+	return s
+}
+
+func TestRoomsApply(t *testing.T) {
+	server := newRoomsServer(t)
+	path := filepath.Join(t.TempDir(), "rooms.yaml")
+	os.WriteFile(path, []byte(roomsTestManifest), 0600)
+
+	if output := runCommand(t, roomsCmd, "", "plan", "-f", path, "--prune"); !strings.Contains(output, "Plan: 1 to create, 1 to update, 1 to delete") {
+		t.Errorf("Expected a plan, got %q", output)
+	}
+
+	// Stdin isn't a terminal in tests, so nothing is applied without --yes
+	if output := runCommand(t, roomsCmd, "", "apply", "-f", path); !strings.Contains(output, "use --yes") {
+		t.Errorf("Expected confirmation to be required, got %q", output)
+	}
+	if len(server.requests) != 0 {
+		t.Fatalf("Expected no changes, got %v", server.requests)
+	}
+
+	// Rooms missing from the manifest are only deleted with --prune
+	output := runCommand(t, roomsCmd, "", "apply", "-f", path, "--yes")
+	if strings.Contains(output, "Deleted room") || len(server.requests) != 2 {
+		t.Errorf("Expected no room to be deleted, got %q and %v", output, server.requests)
+	}
+	server.requests = nil
+
+	output = runCommand(t, roomsCmd, "", "apply", "-f", path, "--yes", "--prune")
+	for _, expected := range []string{"Updated room Movie Night", "Created room Hiking", "Deleted room Old Room"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in output, got %q", expected, output)
+		}
+	}
+	expected := []string{
+		"PUT /rooms/room-movie Movie Night uuid-carol",
+		"POST /rooms Hiking uuid-alice,uuid-carol",
+		"DELETE /rooms/room-old  ",
+	}
+	if strings.Join(server.requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected requests %q", server.requests)
+	}
+}
+
+func TestRoomsDump(t *testing.T) {
+	newRoomsServer(t)
+
+	output := runCommand(t, roomsCmd, "", "dump")
+	var manifest RoomManifest
+	if err := yaml.Unmarshal([]byte(output), &manifest); err != nil {
+		t.Fatalf("Expected a YAML manifest, got %q", output)
+	}
+	if len(manifest.Rooms) != 3 || manifest.Rooms[0].Name != "Book Club" || manifest.Rooms[0].Note != "Weekly" ||
+		strings.Join(manifest.Rooms[0].Members, ",") != "Alice,Bob" {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+
+	path := filepath.Join(t.TempDir(), "rooms.yaml")
+	if output := runCommand(t, roomsCmd, "", "dump", "-f", path); !strings.Contains(output, "Wrote 3 rooms to") {
+		t.Errorf("Expected the manifest to be written, got %q", output)
+	}
+	if _, err := loadRoomManifest(path); err != nil {
+		t.Errorf("Expected the dump to load as a manifest, got %v", err)
+	}
+	if info, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the manifest to exist, got %v", err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the manifest to be private, got %v", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var scheduleSkipMissed bool // Don't catch up on missed runs for a new schedule
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Manage messages sent to Nomis on a schedule by the daemon",
+}
+
+var scheduleAddCmd = &cobra.Command{
+	Use:   "add [nomi] [cron] [message]",
+	Short: "Schedule a message using a cron expression, e.g. \"0 8 * * *\"",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		cron, err := parseCron(args[1])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		nomi, err := resolveNomi(args[0])
+		if err != nil {
+			fmt.Println("Error finding Nomi:", err)
+			return
+		}
+
+		id := make([]byte, 4)
+		if _, err := rand.Read(id); err != nil {
+			fmt.Println("Error generating schedule ID:", err)
+			return
+		}
+
+		schedule := Schedule{
+			ID:         hex.EncodeToString(id),
+			Nomi:       nomi.Name,
+			Cron:       args[1],
+			Message:    args[2],
+			Created:    time.Now().UTC().Format(time.RFC3339),
+			SkipMissed: scheduleSkipMissed,
+		}
+		config.Schedules = append(config.Schedules, schedule)
+		if err := saveConfig(config); err != nil {
+			fmt.Println("Error saving config:", err)
+			return
+		}
+
+		fmt.Printf("Scheduled %s for %s (next run: %s)\n", schedule.ID, nomi.Name, cron.next(time.Now()).Format("2006-01-02 15:04"))
+	},
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List scheduled messages",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(config.Schedules) == 0 {
+			fmt.Println("No scheduled messages")
+			return
+		}
+
+		for _, schedule := range config.Schedules {
+			next := "invalid cron expression"
+			if cron, err := parseCron(schedule.Cron); err == nil {
+				next = cron.next(time.Now()).Format("2006-01-02 15:04")
+			}
+			fmt.Printf("- ID: %s\n  Nomi: %s\n  Cron: %s\n  Message: %s\n  Next run: %s\n\n",
+				schedule.ID, schedule.Nomi, schedule.Cron, schedule.Message, next)
+		}
+	},
+}
+
+var scheduleRemoveCmd = &cobra.Command{
+	Use:   "remove [id]",
+	Short: "Remove a scheduled message",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for i, schedule := range config.Schedules {
+			if schedule.ID != args[0] {
+				continue
+			}
+
+			config.Schedules = append(config.Schedules[:i], config.Schedules[i+1:]...)
+			if err := saveConfig(config); err != nil {
+				fmt.Println("Error saving config:", err)
+				return
+			}
+			fmt.Printf("Removed schedule %s\n", args[0])
+			return
+		}
+		fmt.Printf("No schedule found with the ID: %s\n", args[0])
+	},
+}
+
+func init() {
+	scheduleAddCmd.Flags().BoolVar(&scheduleSkipMissed, "skip-missed", false, "Skip runs missed while the daemon was not running instead of catching up")
+	scheduleCmd.AddCommand(scheduleAddCmd)
+	scheduleCmd.AddCommand(scheduleListCmd)
+	scheduleCmd.AddCommand(scheduleRemoveCmd)
+}
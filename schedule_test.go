@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScheduleCommands(t *testing.T) {
+	upstream := newMockNomiServer()
+	defer upstream.Close()
+	client = NewNomiClient("test-api-key", upstream.URL)
+
+	t.Setenv("NOMI_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	originalConfig := config
+	defer func() { config = originalConfig }()
+	config = &Config{}
+
+	if out := runCommand(t, scheduleCmd, "", "add", "alice", "not a cron", "Hi"); !strings.Contains(out, "invalid cron expression") {
+		t.Errorf("Expected invalid cron error, got %q", out)
+	}
+
+	out := runCommand(t, scheduleCmd, "", "add", "alice", "0 8 * * *", "Good morning")
+	if !strings.Contains(out, "for Alice (next run:") {
+		t.Errorf("Expected schedule confirmation, got %q", out)
+	}
+
+	saved, err := loadConfig()
+	if err != nil || len(saved.Schedules) != 1 {
+		t.Fatalf("Expected one saved schedule, got %+v (%v)", saved, err)
+	}
+	id := saved.Schedules[0].ID
+
+	out = runCommand(t, scheduleCmd, "", "list")
+	for _, line := range []string{"- ID: " + id, "Nomi: Alice", "Cron: 0 8 * * *", "Message: Good morning"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected list to contain %q, got %q", line, out)
+		}
+	}
+
+	if out := runCommand(t, scheduleCmd, "", "remove", "missing"); !strings.Contains(out, "No schedule found") {
+		t.Errorf("Expected missing schedule error, got %q", out)
+	}
+	if out := runCommand(t, scheduleCmd, "", "remove", id); !strings.Contains(out, "Removed schedule "+id) {
+		t.Errorf("Expected removal confirmation, got %q", out)
+	}
+	if out := runCommand(t, scheduleCmd, "", "list"); !strings.Contains(out, "No scheduled messages") {
+		t.Errorf("Expected empty list, got %q", out)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+// interactiveScreen reports whether stdout is a terminal that may be redrawn.
+// Accessible mode never redraws, to keep the transcript readable.
+func interactiveScreen() bool {
+	return !accessible && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// enterAltScreen switches to the terminal's alternate screen buffer and
+// returns a function switching back, which restores the previous screen and
+// scrollback as they were. It does nothing when output isn't a terminal.
+func enterAltScreen() func() {
+	if !interactiveScreen() {
+		return func() {}
+	}
+
+	output := termenv.NewOutput(os.Stdout)
+	restoreConsole, err := termenv.EnableVirtualTerminalProcessing(output) // Needed by older Windows consoles
+	if err != nil {
+		return func() {}
+	}
+
+	output.AltScreen()
+	output.MoveCursor(1, 1)
+	return func() {
+		output.ExitAltScreen()
+		restoreConsole()
+	}
+}
+
+// clearScreen clears the visible screen, never the scrollback, when enabled
+// with clearScreen in the configuration file.
+func clearScreen() {
+	if !config.ClearScreen || !interactiveScreen() {
+		return
+	}
+
+	output := termenv.NewOutput(os.Stdout)
+	if restoreConsole, err := termenv.EnableVirtualTerminalProcessing(output); err == nil {
+		defer restoreConsole()
+		output.ClearScreen()
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestScreenLeavesPipesAlone(t *testing.T) {
+	oldConfig := config
+	config = &Config{ClearScreen: true}
+	defer func() { config = oldConfig }()
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	restore := enterAltScreen()
+	clearScreen()
+	restore()
+
+	w.Close()
+	os.Stdout = oldStdout
+	if out, _ := io.ReadAll(r); len(out) != 0 {
+		t.Errorf("Expected no escape sequences when output is not a terminal, got %q", out)
+	}
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/spf13/cobra"
+)
+
+var searchNomi string   // Only search the conversation with this Nomi
+var searchSince string  // Only search messages sent on or after this date
+var searchUntil string  // Only search messages sent on or before this date
+var searchContext int   // Messages shown before and after each hit
+var searchLimit int     // Maximum number of hits shown
+var searchAround string // Message UUID whose surrounding conversation is shown
+var searchJSON bool     // Print hits as JSON
+
+// searchToken is a word of a message, lowercased, with its byte offsets
+type searchToken struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into lowercase words made of letters and digits
+func tokenize(text string) []searchToken {
+	var tokens []searchToken
+	start := -1
+	for i, r := range text + " " {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, searchToken{term: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	return tokens
+}
+
+// messageTerms returns the words of a message in order, lowercased
+func messageTerms(m archivedMessage) []string {
+	tokens := tokenize(m.Message.Text)
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = token.term
+	}
+	return terms
+}
+
+// queryNode is a parsed search query, matched against the words of a message
+type queryNode interface {
+	matches(terms []string) bool
+}
+
+// termNode matches a word, or any word starting with it when prefix is set
+type termNode struct {
+	term   string
+	prefix bool
+}
+
+func (n termNode) matches(terms []string) bool {
+	for _, term := range terms {
+		if term == n.term || (n.prefix && strings.HasPrefix(term, n.term)) {
+			return true
+		}
+	}
+	return false
+}
+
+// phraseNode matches words appearing next to each other in order
+type phraseNode struct {
+	terms []string
+}
+
+func (n phraseNode) matches(terms []string) bool {
+next:
+	for start := 0; start+len(n.terms) <= len(terms); start++ {
+		for i, term := range n.terms {
+			if terms[start+i] != term {
+				continue next
+			}
+		}
+		return true
+	}
+	return false
+}
+
+type andNode struct{ left, right queryNode }
+
+func (n andNode) matches(terms []string) bool {
+	return n.left.matches(terms) && n.right.matches(terms)
+}
+
+type orNode struct{ left, right queryNode }
+
+func (n orNode) matches(terms []string) bool {
+	return n.left.matches(terms) || n.right.matches(terms)
+}
+
+type notNode struct{ child queryNode }
+
+func (n notNode) matches(terms []string) bool {
+	return !n.child.matches(terms)
+}
+
+// queryParser parses a search query: words must all appear unless joined
+// by OR, "quoted phrases" must appear as written, NOT or a leading - excludes
+// a word, phrase or (group), and a trailing * matches word prefixes.
+type queryParser struct {
+	tokens  []string
+	pos     int
+	negated bool       // Inside a NOT, whose words aren't highlighted
+	terms   []termNode // Words to highlight in hits
+}
+
+// splitQuery splits a query into words, "phrases", parentheses and the - operator
+func splitQuery(query string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '-' && i+1 < len(query) && query[i+1] != ' ':
+			tokens = append(tokens, "-")
+			i++
+		case c == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("missing closing quote in %q", query)
+			}
+			tokens = append(tokens, query[i:i+end+2])
+			i += end + 2
+		default:
+			end := i
+			for end < len(query) && !strings.ContainsRune(" \t()\"", rune(query[end])) {
+				end++
+			}
+			tokens = append(tokens, query[i:end])
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// parseQuery parses a search query, returning it with the words to highlight
+func parseQuery(query string) (queryNode, []termNode, error) {
+	tokens, err := splitQuery(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, nil, fmt.Errorf("unexpected %q in query", p.tokens[p.pos])
+	}
+	return node, p.terms, nil
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var node queryNode
+	for {
+		switch p.peek() {
+		case "", ")", "OR":
+			if node == nil {
+				return nil, fmt.Errorf("expected a word or phrase to search for")
+			}
+			return node, nil
+		case "AND":
+			p.pos++
+			continue
+		}
+
+		next, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			node = next
+		} else {
+			node = andNode{node, next}
+		}
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	token := p.peek()
+	p.pos++
+	switch {
+	case token == "" || token == ")" || token == "OR":
+		return nil, fmt.Errorf("expected a word or phrase to search for")
+	case token == "NOT" || token == "-":
+		p.negated = !p.negated
+		child, err := p.parseUnary()
+		p.negated = !p.negated
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child}, nil
+	case token == "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	prefix := !strings.HasPrefix(token, `"`) && strings.HasSuffix(token, "*")
+	var terms []string
+	for _, t := range tokenize(token) {
+		terms = append(terms, t.term)
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%s has no words to search for", token)
+	}
+	if !p.negated {
+		for i, term := range terms {
+			p.terms = append(p.terms, termNode{term: term, prefix: prefix && i == len(terms)-1})
+		}
+	}
+
+	// Words joined by punctuation, like "don't", are searched as a phrase
+	if len(terms) == 1 {
+		return termNode{term: terms[0], prefix: prefix}, nil
+	}
+	return phraseNode{terms: terms}, nil
+}
+
+// parseSearchDate parses a --since or --until date, either a day in the
+// local time zone or an RFC 3339 time. A day given to --until includes
+// the whole day.
+func parseSearchDate(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: use YYYY-MM-DD or RFC 3339", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
+
+// searchFilter selects the messages searched
+type searchFilter struct {
+	nomi         string // Name or UUID of the conversation's Nomi or room
+	since, until time.Time
+}
+
+func (f searchFilter) matches(m archivedMessage) bool {
+	if uuid, name := m.conversation(); f.nomi != "" && !strings.EqualFold(f.nomi, name) && f.nomi != uuid {
+		return false
+	}
+	if !f.since.IsZero() && m.sent().Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && (m.sent().IsZero() || m.sent().After(f.until)) {
+		return false
+	}
+	return true
+}
+
+// searchMessages scans the messages for those matching a query and filter,
+// and returns their indexes, newest first. Archives are small enough that
+// a scan is quick, and keeping no index means nothing to keep in sync.
+func searchMessages(messages []archivedMessage, query queryNode, filter searchFilter) []int {
+	var hits []int
+	for doc, message := range messages {
+		if filter.matches(message) && query.matches(messageTerms(message)) {
+			hits = append(hits, doc)
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		ti, tj := messages[hits[i]].sent(), messages[hits[j]].sent()
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return hits[i] > hits[j]
+	})
+	return hits
+}
+
+// highlight marks the searched words in a message
+func highlight(text string, terms []termNode) string {
+	var b strings.Builder
+	last := 0
+	for _, token := range tokenize(text) {
+		for _, t := range terms {
+			if token.term == t.term || (t.prefix && strings.HasPrefix(token.term, t.term)) {
+				b.WriteString(text[last:token.start])
+				b.WriteString(theme.Highlight.Render(text[token.start:token.end]))
+				last = token.end
+				break
+			}
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// transcriptLine formats a message on a single line, prefixed with ">"
+// for a hit, and cut to the terminal width unless it is a hit.
+func transcriptLine(m archivedMessage, hit bool, terms []termNode, width int) string {
+	text := strings.Join(strings.Fields(m.Message.Text), " ")
+	if !hit {
+		line := "  " + m.speakerName() + ": " + text
+		return theme.Hint.Render(runewidth.Truncate(line, width, "…"))
+	}
+	return "> " + theme.User.Render(m.speakerName()) + ": " + highlight(text, terms)
+}
+
+// printTranscript prints the messages around a hit in its conversation,
+// with the command jumping to a longer excerpt.
+func printTranscript(w io.Writer, messages []archivedMessage, doc, context int, terms []termNode) {
+	hit := messages[doc]
+	_, name := hit.conversation()
+	when := "unknown time"
+	if t := hit.sent(); !t.IsZero() {
+		when = formatTimestamp(t, "absolute", time.Now())
+	}
+	fmt.Fprintln(w, theme.Title.Render(fmt.Sprintf("── %s · %s ──", name, when)))
+
+	width := terminalWidth()
+	for i := doc - context; i <= doc+context; i++ {
+		if i < 0 || i >= len(messages) || !messages[i].sameConversation(hit) {
+			continue
+		}
+		fmt.Fprintln(w, transcriptLine(messages[i], i == doc, terms, width))
+	}
+	fmt.Fprintln(w, theme.Hint.Render("  Jump: nomi-cli search --around "+hit.Message.UUID))
+}
+
+// findArchivedMessage returns the index of a message by UUID, or -1
+func findArchivedMessage(messages []archivedMessage, uuid string) int {
+	for doc, message := range messages {
+		if message.Message.UUID == uuid {
+			return doc
+		}
+	}
+	return -1
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search the local archive of your conversations",
+	Long: `Search the messages archived while chatting (see "archive" in the configuration file).
+
+All words must appear in a message unless joined by OR. Quote a "phrase" to
+match words in order, exclude words with NOT or a leading -, group with
+parentheses and match word prefixes with a trailing *, for example:
+
+  nomi-cli search trip "to Lisbon" -work --nomi Alice --since 2026-01-01`,
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		if searchAround == "" && len(args) == 0 {
+			fmt.Println("Error: give a query to search for")
+			return
+		}
+		if !archiveExists() {
+			fmt.Println(`No messages archived yet: set "archive": {"enabled": true} in the configuration file to keep them`)
+			return
+		}
+
+		s, err := openStore()
+		if err != nil {
+			fmt.Println("Error opening message archive:", err)
+			return
+		}
+		messages, err := loadArchive(s)
+		if err != nil {
+			fmt.Println("Error reading message archive:", err)
+			return
+		}
+
+		if searchAround != "" {
+			doc := findArchivedMessage(messages, searchAround)
+			if doc < 0 {
+				fmt.Printf("No archived message with UUID %s\n", searchAround)
+				return
+			}
+			context := searchContext
+			if !cmd.Flags().Changed("context") {
+				context = 10
+			}
+			printTranscript(os.Stdout, messages, doc, context, nil)
+			return
+		}
+
+		filter := searchFilter{nomi: searchNomi}
+		if searchSince != "" {
+			if filter.since, err = parseSearchDate(searchSince, false); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+		}
+		if searchUntil != "" {
+			if filter.until, err = parseSearchDate(searchUntil, true); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+		}
+
+		query := strings.Join(args, " ")
+		node, terms, err := parseQuery(query)
+		if err != nil {
+			fmt.Println("Error parsing query:", err)
+			return
+		}
+
+		hits := searchMessages(messages, node, filter)
+		total := len(hits)
+		if searchLimit > 0 && len(hits) > searchLimit {
+			hits = hits[:searchLimit]
+		}
+
+		if searchJSON {
+			results := make([]archivedMessage, len(hits))
+			for i, doc := range hits {
+				results[i] = messages[doc]
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(results); err != nil {
+				fmt.Println("Error encoding results:", err)
+			}
+			return
+		}
+
+		if total == 0 {
+			fmt.Printf("No messages match %q\n", query)
+			return
+		}
+		for i, doc := range hits {
+			if i > 0 {
+				fmt.Println()
+			}
+			printTranscript(os.Stdout, messages, doc, searchContext, terms)
+		}
+		if total > len(hits) {
+			fmt.Printf("\nShowing %d of %d matches, use --limit to see more\n", len(hits), total)
+		}
+	},
+}
+
+func init() {
+	searchCmd.Flags().StringVar(&searchNomi, "nomi", "", "Only search the conversation with this Nomi or room (name or UUID)")
+	searchCmd.Flags().StringVar(&searchSince, "since", "", "Only search messages sent on or after this date (YYYY-MM-DD)")
+	searchCmd.Flags().StringVar(&searchUntil, "until", "", "Only search messages sent on or before this date (YYYY-MM-DD)")
+	searchCmd.Flags().IntVarP(&searchContext, "context", "C", 1, "Messages shown before and after each match")
+	searchCmd.Flags().IntVarP(&searchLimit, "limit", "n", 20, "Maximum number of matches shown (0 for all)")
+	searchCmd.Flags().StringVar(&searchAround, "around", "", "Show the conversation around the message with this UUID")
+	searchCmd.Flags().BoolVar(&searchJSON, "json", false, "Print matching messages as JSON")
+}
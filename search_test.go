@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+// searchFixture is a short conversation with two Nomis
+var searchFixture = []archivedMessage{
+	{NomiUUID: "uuid-alice", NomiName: "Alice", Speaker: speakerUser, Message: Message{UUID: "a1", Text: "I booked the trip to Lisbon!", Sent: "2026-10-01T10:00:00Z"}},
+	{NomiUUID: "uuid-alice", NomiName: "Alice", Speaker: speakerNomi, Message: Message{UUID: "a2", Text: "A trip to Lisbon, how exciting", Sent: "2026-10-01T10:00:05Z"}},
+	{NomiUUID: "uuid-alice", NomiName: "Alice", Speaker: speakerUser, Message: Message{UUID: "a3", Text: "Work has been busy, don't ask", Sent: "2026-10-05T18:00:00Z"}},
+	{NomiUUID: "uuid-alice", NomiName: "Alice", Speaker: speakerNomi, Message: Message{UUID: "a4", Text: "Then let's talk about traveling instead", Sent: "2026-10-05T18:00:04Z"}},
+	{NomiUUID: "uuid-bob", NomiName: "Bob", Speaker: speakerUser, Message: Message{UUID: "b1", Text: "The work trip got cancelled", Sent: "2026-10-03T08:00:00Z"}},
+}
+
+// searchUUIDs runs a query over the fixture and returns the sorted UUIDs of the hits
+func searchUUIDs(t *testing.T, query string, filter searchFilter) string {
+	node, _, err := parseQuery(query)
+	if err != nil {
+		t.Fatalf("Error parsing %q: %v", query, err)
+	}
+	var uuids []string
+	for _, doc := range searchMessages(searchFixture, node, filter) {
+		uuids = append(uuids, searchFixture[doc].Message.UUID)
+	}
+	sort.Strings(uuids)
+	return strings.Join(uuids, ",")
+}
+
+func TestTokenize(t *testing.T) {
+	var terms []string
+	for _, token := range tokenize("Don't go to Zürich, OK?") {
+		terms = append(terms, token.term)
+	}
+	if strings.Join(terms, ",") != "don,t,go,to,zürich,ok" {
+		t.Errorf("Unexpected terms %v", terms)
+	}
+}
+
+func TestSearchQueries(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"trip", "a1,a2,b1"},
+		{"TRIP lisbon", "a1,a2"},
+		{`"trip to lisbon"`, "a1,a2"},
+		{`"lisbon how"`, "a2"},
+		{`"lisbon trip"`, ""},
+		{`"to lisbon" -booked`, "a2"},
+		{"trip NOT work", "a1,a2"},
+		{"booked OR cancelled", "a1,b1"},
+		{"(booked OR busy) work", "a3"},
+		{"travel*", "a4"},
+		{"don't", "a3"},
+		{"paris", ""},
+	}
+
+	for _, test := range tests {
+		if got := searchUUIDs(t, test.query, searchFilter{}); got != test.expected {
+			t.Errorf("Query %q: expected %q, got %q", test.query, test.expected, got)
+		}
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	since, _ := parseSearchDate("2026-10-02", false)
+	until, _ := parseSearchDate("2026-10-03", true)
+
+	if got := searchUUIDs(t, "trip", searchFilter{nomi: "alice"}); got != "a1,a2" {
+		t.Errorf("Expected only Alice's messages, got %q", got)
+	}
+	if got := searchUUIDs(t, "trip", searchFilter{nomi: "uuid-bob"}); got != "b1" {
+		t.Errorf("Expected only Bob's messages, got %q", got)
+	}
+	if got := searchUUIDs(t, "trip OR work", searchFilter{since: since, until: until}); got != "b1" {
+		t.Errorf("Expected only messages of October 2-3, got %q", got)
+	}
+	if _, err := parseSearchDate("last week", false); err == nil {
+		t.Error("Expected an invalid date to be rejected")
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{`"trip`, "(trip", "trip)", "NOT", "trip OR", "?!"} {
+		if _, _, err := parseQuery(query); err == nil {
+			t.Errorf("Expected an error for %q", query)
+		}
+	}
+
+	// Excluded words aren't highlighted
+	_, terms, _ := parseQuery(`"to Lisbon" trav* -work`)
+	if len(terms) != 3 || terms[2].term != "trav" || !terms[2].prefix {
+		t.Errorf("Unexpected highlighted terms %+v", terms)
+	}
+}
+
+func TestSearchCommand(t *testing.T) {
+	setupArchiveTest(t)
+
+	if output := runCommand(t, searchCmd, "", "trip"); !strings.Contains(output, "No messages archived yet") {
+		t.Errorf("Expected a hint to enable the archive, got %q", output)
+	}
+
+	archiveMessages(t, searchFixture...)
+	output := runCommand(t, searchCmd, "", "booked", "--nomi", "Alice")
+	for _, expected := range []string{
+		"── Alice · 2026-10-01",
+		"> You: I booked the trip to Lisbon!",
+		"  Alice: A trip to Lisbon, how exciting",
+		"Jump: nomi-cli search --around a1",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in output, got %q", expected, output)
+		}
+	}
+	if strings.Contains(output, "Work has been busy") {
+		t.Errorf("Expected only one message of context, got %q", output)
+	}
+
+	output = runCommand(t, searchCmd, "", "trip", "--limit", "1")
+	if !strings.Contains(output, "Showing 1 of 3 matches") || !strings.Contains(output, "> You: The work trip") {
+		t.Errorf("Expected the newest match only, got %q", output)
+	}
+
+	output = runCommand(t, searchCmd, "", "--around", "a1")
+	if !strings.Contains(output, "> You: I booked") || !strings.Contains(output, "traveling instead") {
+		t.Errorf("Expected the conversation around a1, got %q", output)
+	}
+
+	output = runCommand(t, searchCmd, "", "lisbon", "--json", "--since", "2026-10-01", "--context", "0")
+	if !strings.Contains(output, `"uuid": "a1"`) || !strings.Contains(output, `"speaker": "nomi"`) {
+		t.Errorf("Expected JSON results, got %q", output)
+	}
+
+	if output := runCommand(t, searchCmd, "", "paris"); !strings.Contains(output, `No messages match "paris"`) {
+		t.Errorf("Expected no matches, got %q", output)
+	}
+}
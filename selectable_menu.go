@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/charmbracelet/bubbletea"
 )
@@ -44,28 +45,28 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 // View renders the UI
 func (m model) View() string {
 	// Title with styling
-	s := fmt.Sprintf("\n%s=== Select a Nomi to Chat With ===%s\n\n", colorYellow, colorReset)
+	s := fmt.Sprintf("\n%s\n\n", theme.Title.Render("=== Select a Nomi to Chat With ==="))
 
 	// List each Nomi with styling
 	for i, nomi := range m.nomis {
 		cursor := "  "
 		if m.cursor == i {
 			// Highlight the selected item
-			cursor = fmt.Sprintf("%s>%s ", colorGreen, colorReset)
-			s += fmt.Sprintf("%s%s%s (%s%s%s)\n",
+			cursor = theme.Highlight.Render(">") + " "
+			s += fmt.Sprintf("%s%s (%s)\n",
 				cursor,
-				colorGreen, nomi.Name, colorBlue, nomi.RelationshipType, colorReset)
+				theme.Highlight.Render(nomi.Name), theme.Nomi.Render(nomi.RelationshipType))
 		} else {
-			s += fmt.Sprintf("%s%s (%s%s%s)\n",
+			s += fmt.Sprintf("%s%s (%s)\n",
 				cursor,
-				nomi.Name, colorCyan, nomi.RelationshipType, colorReset)
+				nomi.Name, theme.Accent.Render(nomi.RelationshipType))
 		}
 	}
 
 	// Instructions with styling
-	s += fmt.Sprintf("\n%s• Use arrow keys or j/k to navigate\n", colorBlue)
-	s += fmt.Sprintf("• Press Enter to start chat\n")
-	s += fmt.Sprintf("• Press q to quit%s\n", colorReset)
+	s += fmt.Sprintf("\n%s\n", theme.Hint.Render("• Use arrow keys or j/k to navigate"))
+	s += fmt.Sprintf("%s\n", theme.Hint.Render("• Press Enter to start chat"))
+	s += fmt.Sprintf("%s\n", theme.Hint.Render("• Press q to quit"))
 
 	return s
 }
@@ -76,6 +77,11 @@ func selectableMenu(nomis []Nomi) (Nomi, error) {
 		return Nomi{}, fmt.Errorf("no Nomis found")
 	}
 
+	// Screen readers can't follow a redrawn menu, so ask for a number instead
+	if accessible {
+		return numberedMenu(nomis, os.Stdin, os.Stdout)
+	}
+
 	// Clear the screen before showing the menu
 	clearScreen()
 
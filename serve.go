@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var serveAddr string    // Address the local server listens on
+var serveOpenAI bool    // Enable the OpenAI-compatible gateway
+var serveProxy bool     // Enable the authenticated Nomi API proxy
+var tokenNomis []string // Nomis a newly issued proxy token may access
+var tokenRateLimit int  // Requests per minute allowed for a newly issued proxy token
+
+// writeJSON encodes v as the JSON response body with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// newServeMux builds the HTTP handler for the enabled serve modes;
+// proxy is nil when the proxy is disabled. With the proxy enabled, the
+// OpenAI endpoints also require a proxy token and honor its allowlist.
+func newServeMux(openai bool, proxy *proxyServer) *http.ServeMux {
+	mux := http.NewServeMux()
+	if openai {
+		if proxy != nil {
+			proxy.registerOpenAI(mux)
+		} else {
+			registerOpenAIRoutes(mux)
+		}
+	}
+	if proxy != nil {
+		proxy.register(mux)
+	}
+	return mux
+}
+
+// proxyLogWriter returns the destination of the proxy access log
+func proxyLogWriter() (io.Writer, error) {
+	if config.Proxy.LogFile == "" {
+		return os.Stderr, nil
+	}
+	return os.OpenFile(config.Proxy.LogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a local HTTP API backed by your Nomis",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !serveOpenAI && !serveProxy {
+			fmt.Println("Nothing to serve: use --openai and/or --proxy")
+			return
+		}
+		if err := openArchive(); err != nil {
+			fmt.Println("Error opening message archive:", err)
+			return
+		}
+
+		var proxy *proxyServer
+		if serveProxy {
+			if len(config.Proxy.Tokens) == 0 {
+				fmt.Println("No proxy tokens configured: create one with 'nomi-cli serve issue-token <name>'")
+				return
+			}
+			out, err := proxyLogWriter()
+			if err != nil {
+				fmt.Println("Error opening proxy log:", err)
+				return
+			}
+			proxy = newProxyServer(config.Proxy.Tokens, log.New(out, "proxy: ", log.LstdFlags))
+			fmt.Printf("Serving Nomi API proxy on http://%s/v1 (%d tokens)\n", serveAddr, len(config.Proxy.Tokens))
+		}
+		if serveOpenAI {
+			fmt.Printf("Serving OpenAI-compatible API on http://%s/v1\n", serveAddr)
+		}
+
+		if err := http.ListenAndServe(serveAddr, newServeMux(serveOpenAI, proxy)); err != nil {
+			fmt.Println("Error running server:", err)
+		}
+	},
+}
+
+var issueTokenCmd = &cobra.Command{
+	Use:   "issue-token [name]",
+	Short: "Issue a local proxy token and save it to the config",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		for _, token := range config.Proxy.Tokens {
+			if token.Name == name {
+				fmt.Printf("A proxy token named %s already exists\n", name)
+				return
+			}
+		}
+
+		secret := make([]byte, 24)
+		if _, err := rand.Read(secret); err != nil {
+			fmt.Println("Error generating token:", err)
+			return
+		}
+		token := ProxyToken{
+			Name:      name,
+			Token:     "nomi-proxy-" + hex.EncodeToString(secret),
+			Nomis:     tokenNomis,
+			RateLimit: tokenRateLimit,
+		}
+
+		config.Proxy.Tokens = append(config.Proxy.Tokens, token)
+		if err := saveConfig(config); err != nil {
+			fmt.Println("Error saving config:", err)
+			return
+		}
+
+		fmt.Printf("Issued proxy token for %s:\n%s\n", name, token.Token)
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "127.0.0.1:8080", "Address to listen on")
+	serveCmd.Flags().BoolVar(&serveOpenAI, "openai", false, "Expose an OpenAI-compatible chat completions API")
+	serveCmd.Flags().BoolVar(&serveProxy, "proxy", false, "Expose the Nomi API to callers holding a local proxy token")
+
+	issueTokenCmd.Flags().StringSliceVar(&tokenNomis, "nomi", nil, "Restrict the token to these Nomi names or UUIDs (repeatable)")
+	issueTokenCmd.Flags().IntVar(&tokenRateLimit, "rate-limit", 0, "Maximum requests per minute (0 for unlimited)")
+	serveCmd.AddCommand(issueTokenCmd)
+}
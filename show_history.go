@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/spf13/cobra"
+)
+
+var historySince string // Only show messages sent on or after this date
+var historyUntil string // Only show messages sent on or before this date
+var historyNoPager bool // Print the whole history instead of paging it
+
+// printHistory writes a conversation as a transcript, with a heading for
+// each day and each message labeled with its time and speaker
+func printHistory(w io.Writer, messages []archivedMessage) {
+	day := ""
+	width := terminalWidth()
+	for _, m := range messages {
+		clock := "     "
+		if t := m.sent(); !t.IsZero() {
+			t = t.Local()
+			if d := t.Format("Monday 2006-01-02"); d != day {
+				if day != "" {
+					fmt.Fprintln(w)
+				}
+				fmt.Fprintln(w, theme.Title.Render("── "+d+" ──"))
+				day = d
+			}
+			clock = t.Format("15:04")
+		}
+
+		label := theme.Nomi.Render(m.speakerName())
+		if m.Speaker == speakerUser {
+			label = theme.User.Render(m.speakerName())
+		}
+		indent := strings.Repeat(" ", runewidth.StringWidth(clock+" "+m.speakerName()+": "))
+		fmt.Fprintf(w, "%s %s: %s\n", theme.Hint.Render(clock), label, renderMarkdown(m.Message.Text, width, indent))
+	}
+}
+
+// pageOutput sends what write prints through $PAGER (less by default)
+// when writing to a terminal, or straight to stdout otherwise
+func pageOutput(write func(io.Writer)) error {
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		if _, err := exec.LookPath("less"); err == nil {
+			// Keep colors, and exit right away when everything fits on one screen
+			pager = "less -RFX"
+		}
+	}
+	if historyNoPager || pager == "" || !interactiveScreen() {
+		write(os.Stdout)
+		return nil
+	}
+
+	args := strings.Fields(pager)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting pager %q: %w", pager, err)
+	}
+	write(in)
+	in.Close()
+	return cmd.Wait()
+}
+
+var showHistoryCmd = &cobra.Command{
+	Use:         "history <nomi>",
+	Short:       "Page through the archived conversation with a Nomi",
+	Args:        cobra.ExactArgs(1),
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		if !archiveExists() {
+			fmt.Println(`No messages archived yet: set "archive": {"enabled": true} in the configuration file, or use 'nomi-cli import'`)
+			return
+		}
+
+		filter := searchFilter{nomi: args[0]}
+		var err error
+		if historySince != "" {
+			if filter.since, err = parseSearchDate(historySince, false); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+		}
+		if historyUntil != "" {
+			if filter.until, err = parseSearchDate(historyUntil, true); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+		}
+
+		s, err := openStore()
+		if err != nil {
+			fmt.Println("Error opening message archive:", err)
+			return
+		}
+		messages, err := loadArchive(s)
+		if err != nil {
+			fmt.Println("Error reading message archive:", err)
+			return
+		}
+
+		var conversation []archivedMessage
+		for _, message := range messages {
+			if filter.matches(message) {
+				conversation = append(conversation, message)
+			}
+		}
+		if len(conversation) == 0 {
+			fmt.Printf("No archived messages with %s\n", args[0])
+			return
+		}
+
+		if err := pageOutput(func(w io.Writer) { printHistory(w, conversation) }); err != nil {
+			fmt.Println("Error showing history:", err)
+		}
+	},
+}
+
+func init() {
+	showHistoryCmd.Flags().StringVar(&historySince, "since", "", "Only show messages sent on or after this date (YYYY-MM-DD)")
+	showHistoryCmd.Flags().StringVar(&historyUntil, "until", "", "Only show messages sent on or before this date (YYYY-MM-DD)")
+	showHistoryCmd.Flags().BoolVar(&historyNoPager, "no-pager", false, "Print the whole history instead of paging it")
+}
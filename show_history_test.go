@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintHistory(t *testing.T) {
+	oldLocal := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = oldLocal }()
+
+	var buf bytes.Buffer
+	printHistory(&buf, statsFixture[:3])
+	output := buf.String()
+
+	for _, expected := range []string{
+		"── Friday 2026-10-16 ──\n09:00 You: Lisbon trip booked\n09:00 Alice: Lisbon is wonderful",
+		"\n\n── Saturday 2026-10-17 ──\n21:30 You: Packing for Lisbon\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in history, got %q", expected, output)
+		}
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	setupArchiveTest(t)
+	if output := runCommand(t, showHistoryCmd, "", "Alice"); !strings.Contains(output, "No messages archived yet") {
+		t.Errorf("Expected a hint to enable the archive, got %q", output)
+	}
+
+	archiveMessages(t, statsFixture...)
+	output := runCommand(t, showHistoryCmd, "", "alice", "--since", "2026-10-17")
+	if strings.Contains(output, "Lisbon trip booked") || !strings.Contains(output, "Packing for Lisbon") || strings.Contains(output, "Hi Bob") {
+		t.Errorf("Expected Alice's messages since October 17, got %q", output)
+	}
+	if output := runCommand(t, showHistoryCmd, "", "Carol"); !strings.Contains(output, "No archived messages with Carol") {
+		t.Errorf("Expected an unknown Nomi error, got %q", output)
+	}
+}
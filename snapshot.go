@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// snapshotVersion is the format version written in new snapshots
+const snapshotVersion = 1
+
+// snapshotDirName is the data directory subfolder holding snapshots
+const snapshotDirName = "snapshots"
+
+var snapshotOutput string // Snapshot file to write instead of the snapshots folder
+var snapshotExitCode bool // Exit with status 1 when a diff finds changes
+
+// Snapshot is the state of an account at a point in time
+type Snapshot struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Nomis   []Nomi    `json:"nomis"`
+	Rooms   []Room    `json:"rooms"`
+}
+
+// takeSnapshot fetches the account's Nomis, each in full, and its rooms
+func takeSnapshot(now time.Time) (*Snapshot, error) {
+	nomis, err := client.GetNomis()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching Nomis: %w", err)
+	}
+	for i, nomi := range nomis {
+		full, err := client.GetNomi(nomi.UUID)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching Nomi %s: %w", nomi.Name, err)
+		}
+		nomis[i] = *full
+	}
+	rooms, err := client.GetRooms()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching rooms: %w", err)
+	}
+	return &Snapshot{Version: snapshotVersion, Created: now.UTC(), Nomis: nomis, Rooms: rooms}, nil
+}
+
+// writeSnapshot saves a snapshot as gzipped JSON
+func writeSnapshot(path string, snapshot *Snapshot) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(zw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshot); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// snapshotDir returns the folder of saved snapshots, creating it if needed
+func snapshotDir() (string, error) {
+	dir, err := dataPath(snapshotDirName)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("error creating snapshot directory: %w", err)
+	}
+	return dir, nil
+}
+
+// listSnapshots returns the saved snapshot files, oldest first
+func listSnapshots() ([]string, error) {
+	dir, err := snapshotDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json.gz"))
+	if err != nil {
+		return nil, err
+	}
+	// Names start with the UTC time they were taken, so they sort by date
+	sort.Strings(files)
+	return files, nil
+}
+
+// resolveSnapshot finds a snapshot given as a path, a file name in the
+// snapshots folder, or "latest" and "previous" for the two newest ones
+func resolveSnapshot(ref string) (string, error) {
+	if ref == "latest" || ref == "previous" {
+		files, err := listSnapshots()
+		if err != nil {
+			return "", err
+		}
+		index := len(files) - 1
+		if ref == "previous" {
+			index--
+		}
+		if index < 0 {
+			return "", fmt.Errorf("not enough snapshots saved for %q", ref)
+		}
+		return files[index], nil
+	}
+
+	if _, err := os.Stat(ref); err == nil {
+		return ref, nil
+	}
+	dir, err := snapshotDir()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{ref, ref + ".json.gz"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return filepath.Join(dir, name), nil
+		}
+	}
+	return "", fmt.Errorf("no snapshot named %s", ref)
+}
+
+// loadSnapshot reads a snapshot, gzipped or not
+func loadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	if snapshot.Version < 1 || snapshot.Version > snapshotVersion {
+		return nil, fmt.Errorf("%s has snapshot version %d, this nomi-cli reads versions 1 to %d", path, snapshot.Version, snapshotVersion)
+	}
+	return &snapshot, nil
+}
+
+// describeSnapshot counts what a snapshot holds, e.g. "3 Nomis and 1 room"
+func describeSnapshot(snapshot *Snapshot) string {
+	nomis, rooms := len(snapshot.Nomis), len(snapshot.Rooms)
+	return fmt.Sprintf("%d %s and %d %s", nomis, plural(nomis, "Nomi", "Nomis"), rooms, plural(rooms, "room", "rooms"))
+}
+
+// diffSnapshots lists the changes from snapshot a to b, matching Nomis and
+// rooms by UUID: additions, removals, renames, relationship changes, room
+// membership, settings and note edits
+func diffSnapshots(a, b *Snapshot) []string {
+	var changes []string
+
+	before := map[string]Nomi{}
+	for _, nomi := range a.Nomis {
+		before[nomi.UUID] = nomi
+	}
+	after := map[string]Nomi{}
+	for _, nomi := range b.Nomis {
+		after[nomi.UUID] = nomi
+		old, ok := before[nomi.UUID]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("+ Nomi %s added (%s)", nomi.Name, nomi.RelationshipType))
+			continue
+		}
+		if old.Name != nomi.Name {
+			changes = append(changes, fmt.Sprintf("~ Nomi %s renamed to %s", old.Name, nomi.Name))
+		}
+		if old.RelationshipType != nomi.RelationshipType {
+			changes = append(changes, fmt.Sprintf("~ Nomi %s relationship: %s → %s", nomi.Name, old.RelationshipType, nomi.RelationshipType))
+		}
+	}
+	for _, nomi := range a.Nomis {
+		if _, ok := after[nomi.UUID]; !ok {
+			changes = append(changes, fmt.Sprintf("- Nomi %s removed", nomi.Name))
+		}
+	}
+
+	rooms := map[string]Room{}
+	for _, room := range a.Rooms {
+		rooms[room.UUID] = room
+	}
+	seen := map[string]bool{}
+	for _, room := range b.Rooms {
+		seen[room.UUID] = true
+		old, ok := rooms[room.UUID]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("+ Room %s added (members: %s)", room.Name, strings.Join(memberNames(room), ", ")))
+			continue
+		}
+		if old.Name != room.Name {
+			changes = append(changes, fmt.Sprintf("~ Room %s renamed to %s", old.Name, room.Name))
+		}
+		if diff := diffMembers(memberNames(old), memberNames(room)); diff != "" {
+			changes = append(changes, fmt.Sprintf("~ Room %s members: %s", room.Name, diff))
+		}
+		if old.Note != room.Note {
+			changes = append(changes, fmt.Sprintf("~ Room %s note: %q → %q", room.Name, old.Note, room.Note))
+		}
+		if old.BackchannelingEnabled != room.BackchannelingEnabled {
+			changes = append(changes, fmt.Sprintf("~ Room %s backchanneling: %v → %v", room.Name, old.BackchannelingEnabled, room.BackchannelingEnabled))
+		}
+	}
+	for _, room := range a.Rooms {
+		if !seen[room.UUID] {
+			changes = append(changes, fmt.Sprintf("- Room %s removed", room.Name))
+		}
+	}
+	return changes
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Save the state of your Nomis and rooms to a versioned archive",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		now := time.Now()
+		snapshot, err := takeSnapshot(now)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		path := snapshotOutput
+		if path == "" {
+			dir, err := snapshotDir()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			path = filepath.Join(dir, now.UTC().Format("20060102T150405Z")+".json.gz")
+		}
+		if err := writeSnapshot(path, snapshot); err != nil {
+			fmt.Println("Error writing snapshot:", err)
+			return
+		}
+		fmt.Printf("Saved %s to %s\n", describeSnapshot(snapshot), path)
+	},
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:         "list",
+	Short:       "List saved snapshots",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := listSnapshots()
+		if err != nil {
+			fmt.Println("Error listing snapshots:", err)
+			return
+		}
+		if len(files) == 0 {
+			fmt.Println("No snapshots saved yet: take one with 'nomi-cli snapshot'")
+			return
+		}
+		for _, file := range files {
+			snapshot, err := loadSnapshot(file)
+			if err != nil {
+				fmt.Printf("%s (%v)\n", filepath.Base(file), err)
+				continue
+			}
+			fmt.Printf("%s  %s\n", strings.TrimSuffix(filepath.Base(file), ".json.gz"), describeSnapshot(snapshot))
+		}
+	},
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:   "diff <a> <b>",
+	Short: "Show what changed between two snapshots",
+	Long: `Show what changed between two snapshots, given as paths, names from
+'snapshot list', or "previous" and "latest" for the two newest ones.`,
+	Args:        cobra.ExactArgs(2),
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		var snapshots [2]*Snapshot
+		for i, ref := range args {
+			path, err := resolveSnapshot(ref)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if snapshots[i], err = loadSnapshot(path); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+		}
+
+		changes := diffSnapshots(snapshots[0], snapshots[1])
+		if len(changes) == 0 {
+			fmt.Println("No changes")
+			return
+		}
+		fmt.Printf("Changes from %s to %s:\n", snapshots[0].Created.Local().Format(time.DateTime), snapshots[1].Created.Local().Format(time.DateTime))
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+		if snapshotExitCode {
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	snapshotCmd.Flags().StringVarP(&snapshotOutput, "output", "o", "", "Write the snapshot to this file instead of the snapshots folder")
+	snapshotDiffCmd.Flags().BoolVar(&snapshotExitCode, "exit-code", false, "Exit with status 1 when there are changes, for monitoring scripts")
+
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotDiffCmd)
+}
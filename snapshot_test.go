@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// snapshotServer serves an account whose state can be changed between snapshots
+func snapshotServer(t *testing.T, nomis *[]Nomi, rooms *[]Room) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/nomis":
+			json.NewEncoder(w).Encode(NomiResponse{Nomis: *nomis})
+		case strings.HasPrefix(r.URL.Path, "/nomis/"):
+			for _, nomi := range *nomis {
+				if r.URL.Path == "/nomis/"+nomi.UUID {
+					nomi.Gender = "Female" // Only in the full details
+					json.NewEncoder(w).Encode(nomi)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/rooms":
+			json.NewEncoder(w).Encode(RoomResponse{Rooms: *rooms})
+		}
+	}))
+	t.Cleanup(server.Close)
+	client = NewNomiClient("test-api-key", server.URL)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	nomis := []Nomi{{UUID: "uuid-alice", Name: "Alice", RelationshipType: "Friend"}}
+	rooms := []Room{{UUID: "room-book", Name: "Book Club", Nomis: nomis}}
+	snapshotServer(t, &nomis, &rooms)
+
+	snapshot, err := takeSnapshot(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if snapshot.Version != snapshotVersion || len(snapshot.Nomis) != 1 || snapshot.Nomis[0].Gender != "Female" || len(snapshot.Rooms) != 1 {
+		t.Errorf("Expected full Nomi details and rooms, got %+v", snapshot)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.json.gz")
+	if err := writeSnapshot(path, snapshot); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	loaded, err := loadSnapshot(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !loaded.Created.Equal(snapshot.Created) || loaded.Nomis[0] != snapshot.Nomis[0] {
+		t.Errorf("Expected the same snapshot back, got %+v", loaded)
+	}
+
+	// Snapshots from a newer version are refused rather than misread
+	os.WriteFile(path, []byte(`{"version": 99}`), 0600)
+	if _, err := loadSnapshot(path); err == nil || !strings.Contains(err.Error(), "snapshot version 99") {
+		t.Errorf("Expected a version error, got %v", err)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	alice := Nomi{UUID: "uuid-alice", Name: "Alice", RelationshipType: "Friend"}
+	bob := Nomi{UUID: "uuid-bob", Name: "Bob", RelationshipType: "Mentor"}
+	carol := Nomi{UUID: "uuid-carol", Name: "Carol", RelationshipType: "Friend"}
+
+	a := &Snapshot{
+		Nomis: []Nomi{alice, bob},
+		Rooms: []Room{
+			{UUID: "room-book", Name: "Book Club", Note: "Monthly", Nomis: []Nomi{alice, bob}},
+			{UUID: "room-old", Name: "Old Room"},
+		},
+	}
+	alice.RelationshipType = "Romantic"
+	b := &Snapshot{
+		Nomis: []Nomi{alice, carol},
+		Rooms: []Room{
+			{UUID: "room-book", Name: "Book Club", Note: "Weekly", BackchannelingEnabled: true, Nomis: []Nomi{alice, carol}},
+			{UUID: "room-new", Name: "Hiking", Nomis: []Nomi{carol}},
+		},
+	}
+
+	expected := []string{
+		"~ Nomi Alice relationship: Friend → Romantic",
+		"+ Nomi Carol added (Friend)",
+		"- Nomi Bob removed",
+		"~ Room Book Club members: +Carol, -Bob",
+		`~ Room Book Club note: "Monthly" → "Weekly"`,
+		"~ Room Book Club backchanneling: false → true",
+		"+ Room Hiking added (members: Carol)",
+		"- Room Old Room removed",
+	}
+	if changes := diffSnapshots(a, b); strings.Join(changes, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected changes:\n%s", strings.Join(changes, "\n"))
+	}
+	if changes := diffSnapshots(b, b); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+}
+
+func TestSnapshotCommands(t *testing.T) {
+	t.Setenv("NOMI_DATA_DIR", t.TempDir())
+	nomis := []Nomi{{UUID: "uuid-alice", Name: "Alice", RelationshipType: "Friend"}}
+	rooms := []Room{}
+	snapshotServer(t, &nomis, &rooms)
+
+	if output := runCommand(t, snapshotCmd, "", "list"); !strings.Contains(output, "No snapshots saved yet") {
+		t.Errorf("Expected no snapshots, got %q", output)
+	}
+	if output := runCommand(t, snapshotCmd, "", "diff", "previous", "latest"); !strings.Contains(output, `not enough snapshots saved for "previous"`) {
+		t.Errorf("Expected an error without snapshots, got %q", output)
+	}
+
+	first := filepath.Join(t.TempDir(), "first.json.gz")
+	if output := runCommand(t, snapshotCmd, "", "-o", first); !strings.Contains(output, "Saved 1 Nomi and 0 rooms to "+first) {
+		t.Errorf("Expected the snapshot to be saved, got %q", output)
+	}
+	nomis[0].RelationshipType = "Mentor"
+	output := runCommand(t, snapshotCmd, "")
+	if !strings.Contains(output, "Saved 1 Nomi and 0 rooms to ") {
+		t.Errorf("Expected the snapshot to be saved, got %q", output)
+	}
+
+	if output := runCommand(t, snapshotCmd, "", "list"); !strings.Contains(output, "Z  1 Nomi and 0 rooms") {
+		t.Errorf("Expected the saved snapshot to be listed, got %q", output)
+	}
+	if output := runCommand(t, snapshotCmd, "", "diff", first, "latest"); !strings.Contains(output, "~ Nomi Alice relationship: Friend → Mentor") {
+		t.Errorf("Expected the relationship change, got %q", output)
+	}
+	if output := runCommand(t, snapshotCmd, "", "diff", "latest", "latest"); !strings.Contains(output, "No changes") {
+		t.Errorf("Expected no changes, got %q", output)
+	}
+	if output := runCommand(t, snapshotCmd, "", "diff", first, "missing"); !strings.Contains(output, "no snapshot named missing") {
+		t.Errorf("Expected an unknown snapshot error, got %q", output)
+	}
+}
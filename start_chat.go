@@ -10,42 +10,109 @@ import (
 
 // startChat initiates a chat session with a Nomi by name
 func startChat(name string) {
-	// Ensure the screen is cleared when the program exits
-	defer clearScreen()
-
 	// Find the UUID for the given name
 	nomiID, err := client.FindNomiByName(name)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
+	nomi := Nomi{UUID: nomiID, Name: name}
+
+	fireHook(HookEvent{Event: eventSessionStart, Source: "chat", NomiUUID: nomiID, NomiName: name})
+	defer fireHook(HookEvent{Event: eventSessionEnd, Source: "chat", NomiUUID: nomiID, NomiName: name})
 
-	// Clear the terminal at the start of the chat
+	// Chat on the alternate screen, leaving the user's scrollback untouched
+	restoreScreen := enterAltScreen()
+	defer restoreScreen()
 	clearScreen()
 
-	fmt.Printf("\n%s=== Chat Session with %s ===%s\n", colorYellow, name, colorReset)
-	fmt.Printf("%s• Type your message and press Enter to send\n", colorBlue)
-	fmt.Printf("%s• Type 'exit' to end the session\n", colorBlue)
-	fmt.Printf("%s• Use arrow keys to navigate within your text%s\n\n", colorBlue, colorReset)
+	fmt.Printf("\n%s\n", theme.Title.Render(fmt.Sprintf("=== Chat Session with %s ===", name)))
+	fmt.Println(theme.Hint.Render("• Type your message and press Enter to send"))
+	fmt.Println(theme.Hint.Render("• Type 'exit' to end the session"))
+	fmt.Println(theme.Hint.Render("• Type '/details' to show the IDs and times of the last message"))
+	fmt.Printf("%s\n\n", theme.Hint.Render("• Use arrow keys to navigate within your text"))
+
+	// Load the input history and open the archive, which may ask for the storage passphrase
+	history, err := openInputHistory(config.History, nomi)
+	if err != nil {
+		fmt.Println("Error loading input history:", err)
+	}
+	if err := openArchive(); err != nil {
+		// Chat without archiving rather than asking again for every message
+		fmt.Println("Error opening message archive, messages won't be archived:", err)
+		config.Archive.Enabled = false
+	}
 
 	// Initialize readline with proper terminal settings
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt:          fmt.Sprintf("%sYou%s: ", colorGreen, colorReset),
+		Prompt:          theme.User.Render("You") + ": ",
 		InterruptPrompt: "^C",
 		EOFPrompt:       "exit",
 
-		// Disable persistent history (in-memory history still works during the session)
+		// History is recorded by inputHistory, which applies the config rules;
+		// Ctrl+R searches it case-insensitively
 		DisableAutoSaveHistory: true,
+		HistoryLimit:           history.cfg.MaxSize,
+		HistorySearchFold:      true,
 	})
 	if err != nil {
 		fmt.Printf("Error initializing input reader: %v\n", err)
 		return
 	}
 	defer rl.Close()
+	history.mirror = func(lines []string) {
+		rl.ResetHistory()
+		for _, line := range lines {
+			rl.SaveHistory(line)
+		}
+	}
+	history.mirror(history.lines)
 
 	// Set auto-completion function if needed later
 	// rl.Config.AutoComplete = completer
 
+	// Ask for the storage passphrase through readline, which owns stdin now
+	readSecret = func(prompt string) (string, error) {
+		secret, err := rl.ReadPassword(prompt)
+		return string(secret), err
+	}
+	defer func() { readSecret = nil }()
+
+	// Messages that fail to send are queued and retried in the background
+	outbox := newChatOutbox(nomi, rl.Stdout())
+	for _, item := range outbox.pending() {
+		fmt.Printf("%s: %s\n", theme.User.Render("You (pending)"), item.Text)
+	}
+	stopRetries := make(chan struct{})
+	defer close(stopRetries)
+	go outbox.run(stopRetries)
+
+	// Send in the background so the user can keep typing while the Nomi replies
+	youPrompt := theme.User.Render("You") + ": "
+	sender := newChatSender(name, outbox, rl.Stdout(), func(typing bool) {
+		if accessible {
+			// Plain status lines instead of a changing prompt
+			if typing {
+				fmt.Fprintln(rl.Stdout(), "Waiting for reply…")
+			} else {
+				fmt.Fprintln(rl.Stdout(), "Reply received")
+			}
+			return
+		}
+		if typing {
+			rl.SetPrompt(theme.Accent.Render(name+" is typing…") + " " + youPrompt)
+		} else {
+			rl.SetPrompt(youPrompt)
+		}
+		rl.Refresh()
+	})
+	defer func() {
+		if n := sender.pending(); n > 0 {
+			fmt.Printf("Waiting for %d replies before leaving…\n", n)
+		}
+		sender.close()
+	}()
+
 	for {
 		input, err := rl.Readline()
 		if err == readline.ErrInterrupt {
@@ -64,23 +131,29 @@ func startChat(name string) {
 			break
 		}
 
-		// Start the spinner
-		stopChan := make(chan bool)
-		go spinner(stopChan)
-
-		// Send the message using the API client
-		chatResponse, err := client.SendMessage(nomiID, input)
+		if strings.TrimSpace(input) == "/details" {
+			printDetails(rl.Stdout(), sender.lastExchange())
+			continue
+		}
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
 
-		// Stop the spinner
-		close(stopChan)
-		fmt.Print("\r") // Clear the spinner line
+		if _, err := history.add(input); err != nil {
+			fmt.Fprintln(rl.Stdout(), "Error saving input history:", err)
+		}
 
-		if err != nil {
-			fmt.Println("Error sending message:", err)
-			continue
+		// Messages typed before the reply arrives are sent after it, in order
+		if ahead := sender.submit(input); ahead > 0 {
+			fmt.Fprintf(rl.Stdout(), "Queued: will be sent after %d earlier %s\n", ahead, plural(ahead, "message", "messages"))
 		}
+	}
+}
 
-		// Display the reply
-		fmt.Printf("%s%s%s: %s\n", colorBlue, name, colorReset, chatResponse.ReplyMessage.Text)
+// plural picks the singular or plural form for n
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return singular
 	}
+	return pluralForm
 }
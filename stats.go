@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var statsFormat string // Output format: text, json or csv
+var statsTerms int     // Number of frequent terms reported
+
+// sparkBars are the levels of a sparkline, from lowest to highest
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// stopWords are common words left out of the most frequent terms
+var stopWords = wordSet(`about after again all also and any are because been but can could did didn does doesn
+	doing don for from had has have her here hers him his how isn its just let like more most much myself not now
+	off once only other our out over own same she should some such than that the their them then there these they
+	this those through too under until very was wasn were what when where which while who whom why will with won
+	would you your yours yourself`)
+
+// wordSet returns the set of space-separated words
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// termCount is a word and how many times it was used
+type termCount struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// streak is a run of consecutive days with messages
+type streak struct {
+	Days  int    `json:"days"`
+	Start string `json:"start,omitempty"` // YYYY-MM-DD
+	End   string `json:"end,omitempty"`
+}
+
+// conversationStats summarizes the archived conversation with a Nomi, or
+// with all Nomis when NomiUUID is empty
+type conversationStats struct {
+	NomiUUID                string      `json:"nomiUuid,omitempty"`
+	NomiName                string      `json:"nomiName"`
+	Messages                int         `json:"messages"`
+	Sent                    int         `json:"sent"`
+	Received                int         `json:"received"`
+	SentWordsPerMessage     float64     `json:"sentWordsPerMessage"`
+	ReceivedWordsPerMessage float64     `json:"receivedWordsPerMessage"`
+	AverageReplySeconds     float64     `json:"averageReplySeconds"` // Between a message and the reply, by their timestamps
+	First                   time.Time   `json:"first"`
+	Last                    time.Time   `json:"last"`
+	Heatmap                 [7][24]int  `json:"heatmap"` // Messages by local weekday (Sunday first) and hour
+	LongestStreak           streak      `json:"longestStreak"`
+	CurrentStreak           streak      `json:"currentStreak"` // Ending today or yesterday
+	TopTerms                []termCount `json:"topTerms"`
+}
+
+// computeStats summarizes messages, which must be grouped by conversation
+// and sorted oldest first as returned by loadArchive
+func computeStats(name string, messages []archivedMessage, terms int, now time.Time) conversationStats {
+	stats := conversationStats{NomiName: name}
+	var sentWords, receivedWords, replies int
+	var replyTime time.Duration
+	days := map[string]bool{}
+	counts := map[string]int{}
+
+	for i, m := range messages {
+		stats.Messages++
+		words := len(strings.Fields(m.Message.Text))
+		if m.Speaker == speakerUser {
+			stats.Sent++
+			sentWords += words
+		} else {
+			stats.Received++
+			receivedWords += words
+
+			// A reply follows the message it answers in the same conversation
+			if i > 0 && messages[i-1].Speaker == speakerUser && messages[i-1].sameConversation(m) {
+				if previous := messages[i-1].sent(); !previous.IsZero() && !m.sent().IsZero() {
+					replyTime += m.sent().Sub(previous)
+					replies++
+				}
+			}
+		}
+
+		for _, token := range tokenize(m.Message.Text) {
+			if len([]rune(token.term)) > 2 && !stopWords[token.term] {
+				counts[token.term]++
+			}
+		}
+
+		t := m.sent()
+		if t.IsZero() {
+			continue
+		}
+		t = t.In(now.Location())
+		if stats.First.IsZero() || t.Before(stats.First) {
+			stats.First = t
+		}
+		if t.After(stats.Last) {
+			stats.Last = t
+		}
+		stats.Heatmap[t.Weekday()][t.Hour()]++
+		days[t.Format("2006-01-02")] = true
+	}
+
+	if stats.Sent > 0 {
+		stats.SentWordsPerMessage = float64(sentWords) / float64(stats.Sent)
+	}
+	if stats.Received > 0 {
+		stats.ReceivedWordsPerMessage = float64(receivedWords) / float64(stats.Received)
+	}
+	if replies > 0 {
+		stats.AverageReplySeconds = (replyTime / time.Duration(replies)).Seconds()
+	}
+	stats.LongestStreak, stats.CurrentStreak = streaks(days, now)
+	stats.TopTerms = topTerms(counts, terms)
+	return stats
+}
+
+// streaks returns the longest run of consecutive active days, and the
+// current one if it ends today or yesterday
+func streaks(days map[string]bool, now time.Time) (longest, current streak) {
+	sorted := make([]string, 0, len(days))
+	for day := range days {
+		sorted = append(sorted, day)
+	}
+	sort.Strings(sorted)
+
+	var run streak
+	var previous time.Time
+	for _, day := range sorted {
+		t, _ := time.ParseInLocation("2006-01-02", day, now.Location())
+		if run.Days > 0 && previous.AddDate(0, 0, 1).Equal(t) {
+			run.Days++
+			run.End = day
+		} else {
+			run = streak{Days: 1, Start: day, End: day}
+		}
+		if run.Days > longest.Days {
+			longest = run
+		}
+		previous = t
+	}
+
+	today := now.Format("2006-01-02")
+	yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
+	if run.End == today || run.End == yesterday {
+		current = run
+	}
+	return longest, current
+}
+
+// topTerms returns the n most frequent terms, ties in alphabetical order
+func topTerms(counts map[string]int, n int) []termCount {
+	terms := make([]termCount, 0, len(counts))
+	for term, count := range counts {
+		terms = append(terms, termCount{Term: term, Count: count})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if n < 0 {
+		n = 0
+	}
+	if len(terms) > n {
+		terms = terms[:n]
+	}
+	return terms
+}
+
+// sparkline draws values as bars scaled to peak, blank for zero
+func sparkline(values []int, peak int) string {
+	var b strings.Builder
+	for _, v := range values {
+		if v == 0 || peak == 0 {
+			b.WriteRune(' ')
+			continue
+		}
+		b.WriteRune(sparkBars[(v*len(sparkBars)-1)/peak])
+	}
+	return b.String()
+}
+
+// statsByNomi splits the archive into one summary per Nomi or room, by name
+func statsByNomi(messages []archivedMessage, terms int, now time.Time) []conversationStats {
+	var all []conversationStats
+	for start := 0; start < len(messages); {
+		end := start
+		for end < len(messages) && messages[end].sameConversation(messages[start]) {
+			end++
+		}
+		uuid, _ := messages[start].conversation()
+		_, name := messages[end-1].conversation()
+		stats := computeStats(name, messages[start:end], terms, now)
+		stats.NomiUUID = uuid
+		all = append(all, stats)
+		start = end
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].NomiName < all[j].NomiName })
+	return all
+}
+
+// printStatsReport writes a summary as a terminal report with sparklines
+func printStatsReport(w io.Writer, s conversationStats) {
+	row := func(label, value string) {
+		fmt.Fprintf(w, "  %-16s%s\n", label, value)
+	}
+	fmt.Fprintln(w, theme.Title.Render(s.NomiName))
+	row("Messages", fmt.Sprintf("%d (%d sent, %d received)", s.Messages, s.Sent, s.Received))
+	row("Words/message", fmt.Sprintf("%.1f sent, %.1f received", s.SentWordsPerMessage, s.ReceivedWordsPerMessage))
+	if s.AverageReplySeconds > 0 {
+		row("Reply time", formatLatency(time.Duration(s.AverageReplySeconds*float64(time.Second)))+" on average")
+	}
+	if s.First.IsZero() {
+		return
+	}
+	row("Active", s.First.Format("2006-01-02")+" → "+s.Last.Format("2006-01-02"))
+	row("Longest streak", fmt.Sprintf("%d %s (%s → %s)", s.LongestStreak.Days, plural(s.LongestStreak.Days, "day", "days"), s.LongestStreak.Start, s.LongestStreak.End))
+	row("Current streak", fmt.Sprintf("%d %s", s.CurrentStreak.Days, plural(s.CurrentStreak.Days, "day", "days")))
+
+	// One line per weekday, Monday first, with a bar per hour
+	peak := 0
+	for _, hours := range s.Heatmap {
+		for _, count := range hours {
+			if count > peak {
+				peak = count
+			}
+		}
+	}
+	fmt.Fprintln(w, "  Activity        "+theme.Hint.Render("0h    6h    12h   18h  23h"))
+	for i := 1; i <= 7; i++ {
+		day := time.Weekday(i % 7)
+		row(day.String()[:3], theme.Accent.Render(sparkline(s.Heatmap[day][:], peak)))
+	}
+
+	if len(s.TopTerms) > 0 {
+		terms := make([]string, len(s.TopTerms))
+		for i, term := range s.TopTerms {
+			terms[i] = fmt.Sprintf("%s (%d)", term.Term, term.Count)
+		}
+		row("Frequent terms", strings.Join(terms, ", "))
+	}
+}
+
+// writeStatsCSV writes one row per summary, for spreadsheets and dashboards
+func writeStatsCSV(w io.Writer, all []conversationStats) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"nomi_uuid", "nomi", "messages", "sent", "received", "sent_words_per_message",
+		"received_words_per_message", "average_reply_seconds", "first", "last", "longest_streak_days",
+		"current_streak_days", "top_terms"})
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) }
+	date := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	for _, s := range all {
+		terms := make([]string, len(s.TopTerms))
+		for i, term := range s.TopTerms {
+			terms[i] = term.Term
+		}
+		out.Write([]string{s.NomiUUID, s.NomiName, strconv.Itoa(s.Messages), strconv.Itoa(s.Sent),
+			strconv.Itoa(s.Received), format(s.SentWordsPerMessage), format(s.ReceivedWordsPerMessage),
+			format(s.AverageReplySeconds), date(s.First), date(s.Last), strconv.Itoa(s.LongestStreak.Days),
+			strconv.Itoa(s.CurrentStreak.Days), strings.Join(terms, " ")})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+var statsCmd = &cobra.Command{
+	Use:         "stats [nomi]",
+	Short:       "Show statistics about your archived conversations",
+	Long:        `Show message counts, words per message, reply times, activity by hour and weekday, streaks and frequent terms, computed from the local conversation archive.`,
+	Args:        cobra.MaximumNArgs(1),
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		if statsFormat != "text" && statsFormat != "json" && statsFormat != "csv" {
+			fmt.Printf("Invalid --format %q: use text, json or csv\n", statsFormat)
+			return
+		}
+		if statsTerms < 0 {
+			fmt.Printf("Invalid --terms %d: must be 0 or more\n", statsTerms)
+			return
+		}
+		if !archiveExists() {
+			fmt.Println(`No messages archived yet: set "archive": {"enabled": true} in the configuration file to keep them`)
+			return
+		}
+
+		s, err := openStore()
+		if err != nil {
+			fmt.Println("Error opening message archive:", err)
+			return
+		}
+		messages, err := loadArchive(s)
+		if err != nil {
+			fmt.Println("Error reading message archive:", err)
+			return
+		}
+
+		// Per-Nomi summaries, followed by the total across Nomis unless one was asked for
+		now := time.Now()
+		all := statsByNomi(messages, statsTerms, now)
+		if len(args) == 1 {
+			var selected []conversationStats
+			for _, stats := range all {
+				if strings.EqualFold(stats.NomiName, args[0]) || stats.NomiUUID == args[0] {
+					selected = append(selected, stats)
+				}
+			}
+			if len(selected) == 0 {
+				fmt.Printf("No archived messages with %s\n", args[0])
+				return
+			}
+			all = selected
+		} else {
+			all = append(all, computeStats("All Nomis", messages, statsTerms, now))
+		}
+
+		switch statsFormat {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(all)
+		case "csv":
+			err = writeStatsCSV(os.Stdout, all)
+		default:
+			for i, stats := range all {
+				if i > 0 {
+					fmt.Println()
+				}
+				printStatsReport(os.Stdout, stats)
+			}
+		}
+		if err != nil {
+			fmt.Println("Error writing statistics:", err)
+		}
+	},
+}
+
+func init() {
+	statsCmd.Flags().StringVar(&statsFormat, "format", "text", "Output format: text, json or csv")
+	statsCmd.Flags().IntVar(&statsTerms, "terms", 10, "Number of frequent terms to report")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statsFixture is three days of chatting with Alice and one with Bob
+var statsFixture = []archivedMessage{
+	{NomiUUID: "uuid-alice", NomiName: "Alice", Speaker: speakerUser, Message: Message{UUID: "a1", Text: "Lisbon trip booked", Sent: "2026-10-16T09:00:00Z"}},
+	{NomiUUID: "uuid-alice", NomiName: "Alice", Speaker: speakerNomi, Message: Message{UUID: "a2", Text: "Lisbon is wonderful in the autumn", Sent: "2026-10-16T09:00:04Z"}},
+	{NomiUUID: "uuid-alice", NomiName: "Alice", Speaker: speakerUser, Message: Message{UUID: "a3", Text: "Packing for Lisbon", Sent: "2026-10-17T21:30:00Z"}},
+	{NomiUUID: "uuid-alice", NomiName: "Alice", Speaker: speakerNomi, Message: Message{UUID: "a4", Text: "Don't forget sunscreen", Sent: "2026-10-17T21:30:02Z"}},
+	{NomiUUID: "uuid-alice", NomiName: "Alice", Speaker: speakerUser, Message: Message{UUID: "a5", Text: "Landed!", Sent: "2026-10-18T12:00:00Z"}},
+	{NomiUUID: "uuid-bob", NomiName: "Bob", Speaker: speakerUser, Message: Message{UUID: "b1", Text: "Hi Bob", Sent: "2026-10-10T12:00:00Z"}},
+}
+
+func TestComputeStats(t *testing.T) {
+	now := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	stats := computeStats("Alice", statsFixture[:5], 2, now)
+
+	if stats.Messages != 5 || stats.Sent != 3 || stats.Received != 2 {
+		t.Errorf("Unexpected counts %+v", stats)
+	}
+	if stats.SentWordsPerMessage != 7.0/3 || stats.ReceivedWordsPerMessage != 4.5 {
+		t.Errorf("Unexpected words per message %.2f/%.2f", stats.SentWordsPerMessage, stats.ReceivedWordsPerMessage)
+	}
+	if stats.AverageReplySeconds != 3 {
+		t.Errorf("Expected 3s average reply time, got %v", stats.AverageReplySeconds)
+	}
+	if stats.Heatmap[time.Friday][9] != 2 || stats.Heatmap[time.Saturday][21] != 2 || stats.Heatmap[time.Sunday][12] != 1 {
+		t.Errorf("Unexpected heatmap %v", stats.Heatmap)
+	}
+	if stats.LongestStreak != (streak{Days: 3, Start: "2026-10-16", End: "2026-10-18"}) || stats.CurrentStreak.Days != 3 {
+		t.Errorf("Unexpected streaks %+v %+v", stats.LongestStreak, stats.CurrentStreak)
+	}
+	if len(stats.TopTerms) != 2 || stats.TopTerms[0] != (termCount{"lisbon", 3}) || stats.TopTerms[1].Term != "autumn" {
+		t.Errorf("Unexpected top terms %+v", stats.TopTerms)
+	}
+
+	// The streak is over after a day without messages
+	if stats := computeStats("Alice", statsFixture[:5], 2, now.AddDate(0, 0, 2)); stats.CurrentStreak.Days != 0 || stats.LongestStreak.Days != 3 {
+		t.Errorf("Expected no current streak, got %+v", stats.CurrentStreak)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := sparkline([]int{0, 1, 4, 8}, 8); got != " ▁▄█" {
+		t.Errorf("Unexpected sparkline %q", got)
+	}
+	if got := sparkline([]int{0, 0}, 0); got != "  " {
+		t.Errorf("Expected a blank sparkline, got %q", got)
+	}
+}
+
+func TestStatsCommand(t *testing.T) {
+	setupArchiveTest(t)
+	// Days and hours are counted in the local time zone
+	oldLocal := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = oldLocal }()
+	archiveMessages(t, statsFixture...)
+
+	output := runCommand(t, statsCmd, "")
+	for _, expected := range []string{"Alice\n", "Bob\n", "All Nomis\n", "Messages        6 (4 sent, 2 received)", "Frequent terms  lisbon (3)", "Longest streak  3 days (2026-10-16 → 2026-10-18)", "Fri    "} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in the report, got %q", expected, output)
+		}
+	}
+
+	output = runCommand(t, statsCmd, "", "alice", "--format", "json")
+	var stats []conversationStats
+	if err := json.Unmarshal([]byte(output), &stats); err != nil {
+		t.Fatalf("Expected JSON output, got %q", output)
+	}
+	if len(stats) != 1 || stats[0].NomiUUID != "uuid-alice" || stats[0].Messages != 5 {
+		t.Errorf("Expected Alice's stats only, got %+v", stats)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(runCommand(t, statsCmd, "", "--format", "csv"))).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected CSV output, got %v", err)
+	}
+	if len(records) != 4 || records[0][0] != "nomi_uuid" || records[2][1] != "Bob" || records[3][2] != "6" {
+		t.Errorf("Unexpected CSV %v", records)
+	}
+
+	if output := runCommand(t, statsCmd, "", "--format", "xml"); !strings.Contains(output, "Invalid --format") {
+		t.Errorf("Expected an invalid format error, got %q", output)
+	}
+	if output := runCommand(t, statsCmd, "", "--terms", "-1"); !strings.Contains(output, "Invalid --terms -1") {
+		t.Errorf("Expected an invalid terms error, got %q", output)
+	}
+	if output := runCommand(t, statsCmd, "", "Carol"); !strings.Contains(output, "No archived messages with Carol") {
+		t.Errorf("Expected an unknown Nomi error, got %q", output)
+	}
+	if terms := topTerms(map[string]int{"lisbon": 3}, -1); len(terms) != 0 {
+		t.Errorf("Expected no terms for a negative count, got %+v", terms)
+	}
+}
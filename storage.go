@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
+)
+
+// storageKeyFile holds the data key, encrypted with the storage passphrase
+const storageKeyFile = "storage.key"
+
+// keyringStorageUser is the keyring entry caching the data key while storage is unlocked
+const keyringStorageUser = "storage-key"
+
+// storageSuffix marks files encrypted with the data key
+const storageSuffix = ".enc"
+
+// secureStore keeps message data encrypted at rest with AES-256-GCM. Files
+// are sequences of records, one base64 line each, so logs can be appended
+// to without rewriting them. The file name is authenticated with each record.
+type secureStore struct {
+	dir  string
+	aead cipher.AEAD
+}
+
+var store *secureStore // Opened on first use by openStore
+
+func newSecureStore(dir string, key []byte) (*secureStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage key: %w", err)
+	}
+	return &secureStore{dir: dir, aead: aead}, nil
+}
+
+func (s *secureStore) path(name string) string {
+	return filepath.Join(s.dir, name+storageSuffix)
+}
+
+// seal encrypts a record for the named file
+func (s *secureStore) seal(name string, plaintext []byte) []byte {
+	nonce := make([]byte, s.aead.NonceSize())
+	rand.Read(nonce)
+	sealed := s.aead.Seal(nonce, nonce, plaintext, []byte(name))
+	line := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(line, sealed)
+	return append(line, '\n')
+}
+
+// open decrypts a record of the named file
+func (s *secureStore) open(name string, line []byte) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(string(line))
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("corrupt record in %s", name)
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting %s (wrong storage key?)", name)
+	}
+	return plaintext, nil
+}
+
+// appendRecord adds an encrypted record to the end of the named file
+func (s *secureStore) appendRecord(name string, data []byte) error {
+	f, err := os.OpenFile(s.path(name), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", name, err)
+	}
+	defer f.Close()
+
+	// Start a new line after a record cut short by a crash, so that it
+	// doesn't corrupt this one too
+	line := s.seal(name, data)
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// readRecords decrypts every record of the named file; a missing file has
+// none. Unreadable records, such as one cut short by a crash during an
+// append, are skipped with a warning, unless no record can be read at all,
+// which points at a wrong key rather than damage.
+func (s *secureStore) readRecords(name string) ([][]byte, error) {
+	f, err := os.Open(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", name, err)
+	}
+	defer f.Close()
+
+	var records [][]byte
+	var firstErr error
+	skipped := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		record, err := s.open(name, scanner.Bytes())
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			skipped++
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		if len(records) == 0 {
+			return nil, firstErr
+		}
+		fmt.Fprintf(os.Stderr, "Warning: skipped %d unreadable %s in %s\n", skipped, plural(skipped, "record", "records"), name)
+	}
+	return records, nil
+}
+
+// writeRecords atomically replaces the named file with the given records
+func (s *secureStore) writeRecords(name string, records [][]byte) error {
+	var sealed bytes.Buffer
+	for _, record := range records {
+		sealed.Write(s.seal(name, record))
+	}
+	tmp := s.path(name) + ".tmp"
+	if err := os.WriteFile(tmp, sealed.Bytes(), 0600); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	if err := os.Rename(tmp, s.path(name)); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeFile atomically replaces the named file with a single encrypted record
+func (s *secureStore) writeFile(name string, data []byte) error {
+	return s.writeRecords(name, [][]byte{data})
+}
+
+// readFile decrypts a file written by writeFile; a missing file reads as empty
+func (s *secureStore) readFile(name string) ([]byte, error) {
+	records, err := s.readRecords(name)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[len(records)-1], nil
+}
+
+// recordWriter appends each Write call as one encrypted record of the named file
+type recordWriter struct {
+	store *secureStore
+	name  string
+}
+
+func (w recordWriter) Write(p []byte) (int, error) {
+	if err := w.store.appendRecord(w.name, bytes.TrimRight(p, "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writer returns an io.Writer appending encrypted records to the named file
+func (s *secureStore) writer(name string) io.Writer {
+	return recordWriter{store: s, name: name}
+}
+
+// list returns the names of the files in the store starting with prefix
+func (s *secureStore) list(prefix string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, prefix+"*"+storageSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = strings.TrimSuffix(filepath.Base(file), storageSuffix)
+	}
+	return names, nil
+}
+
+// rekeySuffix marks a file re-encrypted by rekey, waiting to replace the original
+const rekeySuffix = ".rekey"
+
+// rekey re-encrypts every file in the store with a new key. All files are
+// re-encrypted to copies first, then commit saves the new key, and only
+// then do the copies replace the originals: until the key is saved, a
+// failure leaves the store readable with the old key.
+func (s *secureStore) rekey(next *secureStore, commit func() error) error {
+	names, err := s.list("")
+	if err != nil {
+		return err
+	}
+
+	var copies []string
+	discard := func() {
+		for _, path := range copies {
+			os.Remove(path)
+		}
+	}
+	for _, name := range names {
+		records, err := s.readRecords(name)
+		if err != nil {
+			discard()
+			return err
+		}
+
+		var sealed bytes.Buffer
+		for _, record := range records {
+			sealed.Write(next.seal(name, record))
+		}
+		path := next.path(name) + rekeySuffix
+		if err := os.WriteFile(path, sealed.Bytes(), 0600); err != nil {
+			discard()
+			return fmt.Errorf("error writing %s: %w", name, err)
+		}
+		copies = append(copies, path)
+	}
+
+	if err := commit(); err != nil {
+		discard()
+		return err
+	}
+	for i, name := range names {
+		if err := os.Rename(copies[i], next.path(name)); err != nil {
+			return fmt.Errorf("error replacing %s: %w (the new key is saved; rename the remaining %s files to finish)", name, err, rekeySuffix)
+		}
+	}
+	return nil
+}
+
+// writeStorageKey wraps the data key with a passphrase into the key file
+func writeStorageKey(key []byte, passphrase string) error {
+	path, err := dataPath(storageKeyFile)
+	if err != nil {
+		return err
+	}
+	wrapped, err := encryptWithPassphrase(key, passphrase)
+	if err != nil {
+		return fmt.Errorf("error encrypting storage key: %w", err)
+	}
+	// Replace the key file atomically, as losing it loses every message
+	if err := os.WriteFile(path+".tmp", wrapped, 0600); err != nil {
+		return fmt.Errorf("error writing storage key: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("error writing storage key: %w", err)
+	}
+	return nil
+}
+
+// unlockStorageKey decrypts the data key with the passphrase, creating a
+// new key protected by a new passphrase the first time storage is used.
+func unlockStorageKey() ([]byte, error) {
+	path, err := dataPath(storageKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		passphrase, err := readPassphrase("New passphrase for local message storage: ", true)
+		if err != nil {
+			return nil, err
+		}
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("error generating storage key: %w", err)
+		}
+		return key, writeStorageKey(key, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading storage key: %w", err)
+	}
+
+	passphrase, err := readPassphrase("Passphrase for local message storage: ", false)
+	if err != nil {
+		return nil, err
+	}
+	key, err := decryptWithPassphrase(wrapped, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("error unlocking storage: %w", err)
+	}
+	return key, nil
+}
+
+// loadStorageKey returns the data key from the keyring while storage is
+// unlocked, or from the passphrase-protected key file otherwise.
+func loadStorageKey() ([]byte, error) {
+	if encoded, err := keyring.Get(keyringService, keyringStorageUser); err == nil {
+		if key, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+			return key, nil
+		}
+	}
+	return unlockStorageKey()
+}
+
+// openStore opens the encrypted store in the data directory
+func openStore() (*secureStore, error) {
+	if store != nil {
+		return store, nil
+	}
+
+	dir, err := dataDir()
+	if err != nil {
+		return nil, err
+	}
+	key, err := loadStorageKey()
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSecureStore(dir, key)
+	if err != nil {
+		return nil, err
+	}
+	store = s
+	return store, nil
+}
+
+// sensitiveFile reports whether a data directory file holds keys or
+// messages: the storage key, the stored credentials and encrypted files
+func sensitiveFile(name string) bool {
+	return name == storageKeyFile || name == credentialsFile || strings.HasSuffix(name, storageSuffix)
+}
+
+// checkPermissions refuses to run when the storage key, the stored
+// credentials or encrypted files can be read by other users, and warns
+// when the config file or the data directory can, as umask defaults
+// often leave them. Windows has no permission bits to check.
+func checkPermissions(warn io.Writer) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	var paths []string
+	if path, err := configPath(); err == nil {
+		paths = append(paths, path)
+	}
+	if dir, err := dataDir(); err == nil {
+		paths = append(paths, dir)
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.Mode().Perm()&0077 == 0 {
+			continue
+		}
+		fix := "chmod 600"
+		if info.IsDir() {
+			fix = "chmod 700"
+		}
+		if !info.IsDir() && sensitiveFile(info.Name()) {
+			return fmt.Errorf("%s is accessible by other users (mode %v); fix it with: %s %s", path, info.Mode().Perm(), fix, path)
+		}
+		fmt.Fprintf(warn, "Warning: %s is accessible by other users (mode %v); fix it with: %s %s\n", path, info.Mode().Perm(), fix, path)
+	}
+	return nil
+}
+
+var storageCmd = &cobra.Command{
+	Use:   "storage",
+	Short: "Manage encryption of locally stored messages",
+}
+
+var storageUnlockCmd = &cobra.Command{
+	Use:         "unlock",
+	Short:       "Hold the storage key in the system keyring so no passphrase is needed",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		key, err := unlockStorageKey()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if err := keyring.Set(keyringService, keyringStorageUser, base64.StdEncoding.EncodeToString(key)); err != nil {
+			fmt.Println("Error storing key in the system keyring:", err)
+			return
+		}
+		fmt.Println("Storage unlocked: the key is held in the system keyring")
+	},
+}
+
+var storageLockCmd = &cobra.Command{
+	Use:         "lock",
+	Short:       "Remove the storage key from the system keyring so the passphrase is required",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := keyring.Delete(keyringService, keyringStorageUser); err != nil {
+			fmt.Println("Storage is already locked")
+			return
+		}
+		fmt.Println("Storage locked")
+	},
+}
+
+var storageRekeyCmd = &cobra.Command{
+	Use:         "rekey",
+	Short:       "Re-encrypt stored messages with a new key and passphrase",
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{"apiKey": "optional"},
+	Run: func(cmd *cobra.Command, args []string) {
+		current, err := openStore()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		// A running daemon would keep appending records with the old key,
+		// so refuse to run alongside it and keep it from starting meanwhile
+		unlockDaemon, err := tryLockFile(filepath.Join(current.dir, daemonLockName))
+		if errors.Is(err, errFileLocked) {
+			fmt.Println("The daemon is running: stop it before rekeying storage")
+			return
+		}
+		if err != nil {
+			fmt.Println("Error locking daemon:", err)
+			return
+		}
+		defer unlockDaemon()
+
+		// Hold the outbox too, so that a chat doesn't queue messages with the old key
+		unlockOutbox, err := lockOutbox(current)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer unlockOutbox()
+
+		// NOMI_PASSPHRASE unlocked the current key, so the new one comes from
+		// NOMI_NEW_PASSPHRASE or a prompt
+		passphrase := os.Getenv("NOMI_NEW_PASSPHRASE")
+		if passphrase == "" {
+			os.Unsetenv("NOMI_PASSPHRASE")
+			if passphrase, err = readPassphrase("New passphrase for local message storage: ", true); err != nil {
+				fmt.Println("Error reading passphrase:", err)
+				return
+			}
+		}
+
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			fmt.Println("Error generating storage key:", err)
+			return
+		}
+		next, err := newSecureStore(current.dir, key)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		// The new key is saved once every file is re-encrypted, so a failure
+		// before then leaves the old key and files in place
+		if err := current.rekey(next, func() error { return writeStorageKey(key, passphrase) }); err != nil {
+			fmt.Println("Error re-encrypting storage:", err)
+			return
+		}
+		store = next
+
+		// Keep storage unlocked if it was
+		if _, err := keyring.Get(keyringService, keyringStorageUser); err == nil {
+			if err := keyring.Set(keyringService, keyringStorageUser, base64.StdEncoding.EncodeToString(key)); err != nil {
+				fmt.Println("Error updating the key in the system keyring, run 'nomi-cli storage lock' then 'storage unlock':", err)
+			}
+		}
+		fmt.Println("Storage re-encrypted with a new key")
+	},
+}
+
+func init() {
+	storageCmd.AddCommand(storageUnlockCmd)
+	storageCmd.AddCommand(storageLockCmd)
+	storageCmd.AddCommand(storageRekeyCmd)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// newTestStore opens a store with a random key in a temporary directory
+func newTestStore(t *testing.T) *secureStore {
+	key := make([]byte, 32)
+	rand.Read(key)
+	s, err := newSecureStore(t.TempDir(), key)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return s
+}
+
+func TestSecureStoreRecords(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, record := range []string{`{"text":"first"}`, `{"text":"second"}`} {
+		if err := s.appendRecord("messages", []byte(record)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	data, _ := os.ReadFile(s.path("messages"))
+	if bytes.Contains(data, []byte("first")) {
+		t.Error("Expected records to be encrypted on disk")
+	}
+	if info, _ := os.Stat(s.path("messages")); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600, got %v", info.Mode().Perm())
+	}
+
+	records, err := s.readRecords("messages")
+	if err != nil || len(records) != 2 || string(records[1]) != `{"text":"second"}` {
+		t.Errorf("Expected both records back, got %q (%v)", records, err)
+	}
+
+	// Records are bound to their file, so they can't be moved to another one
+	os.Rename(s.path("messages"), s.path("other"))
+	if _, err := s.readRecords("other"); err == nil {
+		t.Error("Expected an error reading records under another name")
+	}
+
+	if records, err := s.readRecords("missing"); err != nil || records != nil {
+		t.Errorf("Expected no records for a missing file, got %q (%v)", records, err)
+	}
+}
+
+func TestSecureStoreWriteFile(t *testing.T) {
+	s := newTestStore(t)
+
+	s.writeFile("state", []byte("one"))
+	s.writeFile("state", []byte("two"))
+	data, err := s.readFile("state")
+	if err != nil || string(data) != "two" {
+		t.Errorf("Expected the latest content, got %q (%v)", data, err)
+	}
+
+	io.WriteString(s.writer("log"), "line\n")
+	records, _ := s.readRecords("log")
+	if len(records) != 1 || string(records[0]) != "line" {
+		t.Errorf("Expected one record per write, got %q", records)
+	}
+}
+
+func TestSecureStoreWrongKey(t *testing.T) {
+	s := newTestStore(t)
+	s.appendRecord("messages", []byte("secret"))
+
+	other := newTestStore(t)
+	other.dir = s.dir
+	if _, err := other.readRecords("messages"); err == nil {
+		t.Error("Expected an error with the wrong key")
+	}
+}
+
+func TestSecureStoreSkipsTruncatedRecord(t *testing.T) {
+	s := newTestStore(t)
+	s.appendRecord("messages", []byte("first"))
+	s.appendRecord("messages", []byte("second"))
+
+	// A crash cut the last record short
+	info, _ := os.Stat(s.path("messages"))
+	os.Truncate(s.path("messages"), info.Size()-10)
+	records, err := s.readRecords("messages")
+	if err != nil || len(records) != 1 || string(records[0]) != "first" {
+		t.Fatalf("Expected the truncated record to be skipped, got %q (%v)", records, err)
+	}
+
+	// Later records start on a line of their own
+	s.appendRecord("messages", []byte("third"))
+	records, err = s.readRecords("messages")
+	if err != nil || len(records) != 2 || string(records[1]) != "third" {
+		t.Errorf("Expected records after the truncated one to be read, got %q (%v)", records, err)
+	}
+}
+
+func TestStorageKeyUnlock(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("NOMI_DATA_DIR", t.TempDir())
+	t.Setenv("NOMI_PASSPHRASE", "correct horse")
+
+	// The first use creates the key
+	key, err := loadStorageKey()
+	if err != nil || len(key) != 32 {
+		t.Fatalf("Expected a new 32 byte key, got %d bytes (%v)", len(key), err)
+	}
+	again, err := loadStorageKey()
+	if err != nil || !bytes.Equal(key, again) {
+		t.Errorf("Expected the same key on the next use (%v)", err)
+	}
+
+	t.Setenv("NOMI_PASSPHRASE", "wrong")
+	if _, err := loadStorageKey(); err == nil {
+		t.Error("Expected an error for a wrong passphrase")
+	}
+
+	// Unlocked storage doesn't need the passphrase
+	t.Setenv("NOMI_PASSPHRASE", "correct horse")
+	if out := runCommand(t, storageCmd, "", "unlock"); !strings.Contains(out, "Storage unlocked") {
+		t.Errorf("Expected storage to be unlocked, got %q", out)
+	}
+	t.Setenv("NOMI_PASSPHRASE", "wrong")
+	if unlocked, err := loadStorageKey(); err != nil || !bytes.Equal(key, unlocked) {
+		t.Errorf("Expected the key from the keyring (%v)", err)
+	}
+
+	if out := runCommand(t, storageCmd, "", "lock"); !strings.Contains(out, "Storage locked") {
+		t.Errorf("Expected storage to be locked, got %q", out)
+	}
+	if _, err := loadStorageKey(); err == nil {
+		t.Error("Expected the passphrase to be required again")
+	}
+}
+
+func TestStorageRekey(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("NOMI_DATA_DIR", t.TempDir())
+	t.Setenv("NOMI_PASSPHRASE", "old passphrase")
+	t.Setenv("NOMI_NEW_PASSPHRASE", "new passphrase")
+	store = nil
+	defer func() { store = nil }()
+
+	s, err := openStore()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	s.appendRecord("messages", []byte("hello"))
+	before, _ := os.ReadFile(s.path("messages"))
+
+	// A running daemon holds its lock
+	unlock, err := lockFile(filepath.Join(s.dir, daemonLockName))
+	if err != nil {
+		t.Fatalf("Expected the daemon lock, got %v", err)
+	}
+	if out := runCommand(t, storageCmd, "", "rekey"); !strings.Contains(out, "The daemon is running") {
+		t.Errorf("Expected rekeying to wait for the daemon to stop, got %q", out)
+	}
+	unlock()
+
+	if out := runCommand(t, storageCmd, "", "rekey"); !strings.Contains(out, "re-encrypted") {
+		t.Fatalf("Expected storage to be re-encrypted, got %q", out)
+	}
+
+	after, _ := os.ReadFile(s.path("messages"))
+	if bytes.Equal(before, after) {
+		t.Error("Expected the file to be rewritten")
+	}
+
+	store = nil
+	t.Setenv("NOMI_PASSPHRASE", "new passphrase")
+	s, err = openStore()
+	if err != nil {
+		t.Fatalf("Expected the new passphrase to unlock storage, got %v", err)
+	}
+	if records, err := s.readRecords("messages"); err != nil || len(records) != 1 || string(records[0]) != "hello" {
+		t.Errorf("Expected the record to survive rekeying, got %q (%v)", records, err)
+	}
+}
+
+func TestRekeyFailureKeepsOldKey(t *testing.T) {
+	s := newTestStore(t)
+	s.appendRecord("a-messages", []byte("hello"))
+	os.WriteFile(s.path("b-corrupt"), []byte("not a record\n"), 0600)
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	next, _ := newSecureStore(s.dir, key)
+	committed := false
+	err := s.rekey(next, func() error { committed = true; return nil })
+	if err == nil || committed {
+		t.Fatalf("Expected rekey to fail before saving the key, got %v (committed %v)", err, committed)
+	}
+
+	if records, err := s.readRecords("a-messages"); err != nil || len(records) != 1 {
+		t.Errorf("Expected the old key to still read the store, got %q (%v)", records, err)
+	}
+	if copies, _ := filepath.Glob(filepath.Join(s.dir, "*"+rekeySuffix)); len(copies) != 0 {
+		t.Errorf("Expected re-encrypted copies to be removed, got %v", copies)
+	}
+
+	// A failure to save the key also leaves the store as it was
+	os.Remove(s.path("b-corrupt"))
+	err = s.rekey(next, func() error { return io.ErrShortWrite })
+	if err != io.ErrShortWrite {
+		t.Fatalf("Expected the commit error, got %v", err)
+	}
+	if records, err := s.readRecords("a-messages"); err != nil || len(records) != 1 {
+		t.Errorf("Expected the old key to still read the store, got %q (%v)", records, err)
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("No permission bits on Windows")
+	}
+	dir := t.TempDir()
+	os.Chmod(dir, 0700)
+	t.Setenv("NOMI_DATA_DIR", dir)
+	t.Setenv("NOMI_CONFIG", filepath.Join(dir, "config.json"))
+
+	var warnings bytes.Buffer
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte("{}"), 0600)
+	os.WriteFile(filepath.Join(dir, storageKeyFile), []byte("key"), 0600)
+	if err := checkPermissions(&warnings); err != nil || warnings.Len() != 0 {
+		t.Errorf("Expected private files to pass, got %v (%s)", err, warnings.String())
+	}
+
+	// Umask defaults on the config and the directory only warn
+	os.Chmod(filepath.Join(dir, "config.json"), 0644)
+	os.Chmod(dir, 0755)
+	if err := checkPermissions(&warnings); err != nil {
+		t.Errorf("Expected a readable config and directory to only warn, got %v", err)
+	}
+	if !strings.Contains(warnings.String(), "chmod 600 "+filepath.Join(dir, "config.json")) || !strings.Contains(warnings.String(), "chmod 700 "+dir) {
+		t.Errorf("Expected warnings with the chmod fixes, got %q", warnings.String())
+	}
+
+	// Keys, credentials and encrypted messages are refused
+	for _, name := range []string{storageKeyFile, credentialsFile, "messages-abc" + storageSuffix} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte("secret"), 0644)
+		os.Chmod(path, 0644)
+		err := checkPermissions(io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "chmod 600 "+path) {
+			t.Errorf("Expected a readable %s to be refused, got %v", name, err)
+		}
+		os.Chmod(path, 0600)
+	}
+}
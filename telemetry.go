@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the client's spans and metrics
+const instrumentationName = "github.com/sjourdan/nomi-cli"
+
+// requestMetrics are the instruments recording API calls
+type requestMetrics struct {
+	duration metric.Float64Histogram
+	errors   metric.Int64Counter
+}
+
+// clientMetrics are created once from the global meter, which hands them
+// over to the provider installed by setupTelemetry or an embedding service
+var clientMetrics = newRequestMetrics(otel.Meter(instrumentationName))
+
+// newRequestMetrics creates the request instruments, falling back to no-ops
+func newRequestMetrics(meter metric.Meter) requestMetrics {
+	m := requestMetrics{duration: noop.Float64Histogram{}, errors: noop.Int64Counter{}}
+	if histogram, err := meter.Float64Histogram("nomi.client.request.duration",
+		metric.WithDescription("Duration of Nomi API requests"),
+		metric.WithUnit("s")); err == nil {
+		m.duration = histogram
+	}
+	if counter, err := meter.Int64Counter("nomi.client.request.errors",
+		metric.WithDescription("Failed Nomi API requests"),
+		metric.WithUnit("{request}")); err == nil {
+		m.errors = counter
+	}
+	return m
+}
+
+// retryCountKey holds in a context how many times a request was tried before
+type retryCountKey struct{}
+
+// withRetryCount marks the requests made with ctx as retried n times, for
+// callers retrying failed requests such as the outbox
+func withRetryCount(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, retryCountKey{}, n)
+}
+
+// endpointRoute replaces the IDs in an API endpoint with placeholders, so
+// spans and metrics group by route, and returns the Nomi and room IDs found.
+func endpointRoute(endpoint string) (route, nomiID, roomID string) {
+	segments := strings.Split(endpoint, "/")
+	for i := 1; i < len(segments); i++ {
+		if segments[i] == "" {
+			continue
+		}
+		switch segments[i-1] {
+		case "nomis":
+			nomiID = segments[i]
+			segments[i] = "{id}"
+		case "rooms":
+			roomID = segments[i]
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/"), nomiID, roomID
+}
+
+// startRequestSpan starts a client span for an API call, a child of any
+// span in ctx. The global tracer is a no-op unless telemetry was set up, by
+// the CLI or an embedding service.
+func startRequestSpan(ctx context.Context, method, endpoint string) (context.Context, trace.Span) {
+	route, nomiID, roomID := endpointRoute(endpoint)
+	retries, _ := ctx.Value(retryCountKey{}).(int)
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", method),
+		attribute.String("http.route", route),
+		attribute.Int("nomi.retry.count", retries),
+	}
+	if nomiID != "" {
+		attrs = append(attrs, attribute.String("nomi.uuid", nomiID))
+	}
+	if roomID != "" {
+		attrs = append(attrs, attribute.String("nomi.room.uuid", roomID))
+	}
+
+	return otel.Tracer(instrumentationName).Start(ctx, method+" "+route,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endRequestSpan ends a client span and records the request's latency and any error
+func endRequestSpan(span trace.Span, start time.Time, method, endpoint string, statusCode int, err error) {
+	defer span.End()
+
+	route, _, _ := endpointRoute(endpoint)
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", method),
+		attribute.String("http.route", route),
+	}
+	if statusCode != 0 {
+		attrs = append(attrs, attribute.Int("http.response.status_code", statusCode))
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	}
+
+	ctx := context.Background()
+
+	if err != nil {
+		// API errors are counted by status code, other failures by where they happened
+		errorType := "transport"
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			errorType = strconv.Itoa(apiErr.StatusCode)
+		} else if statusCode != 0 {
+			errorType = "decode"
+		}
+		attrs = append(attrs, attribute.String("error.type", errorType))
+
+		span.SetAttributes(attribute.String("error.type", errorType))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		clientMetrics.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+	clientMetrics.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+}
+
+// setupTelemetry installs global trace and meter providers for the configured
+// exporter and returns a function flushing them. The stdout exporter writes
+// to stderr so it never mixes with command output.
+func setupTelemetry(cfg TelemetryConfig) (func(context.Context) error, error) {
+	ctx := context.Background()
+
+	var spanExporter sdktrace.SpanExporter
+	var metricExporter sdkmetric.Exporter
+	var err error
+
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		traceOpts := []otlptracehttp.Option{}
+		metricOpts := []otlpmetrichttp.Option{}
+		if cfg.Endpoint != "" {
+			traceOpts = append(traceOpts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+			metricOpts = append(metricOpts, otlpmetrichttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			traceOpts = append(traceOpts, otlptracehttp.WithInsecure())
+			metricOpts = append(metricOpts, otlpmetrichttp.WithInsecure())
+		}
+		if spanExporter, err = otlptracehttp.New(ctx, traceOpts...); err != nil {
+			return nil, fmt.Errorf("error creating OTLP trace exporter: %w", err)
+		}
+		if metricExporter, err = otlpmetrichttp.New(ctx, metricOpts...); err != nil {
+			return nil, fmt.Errorf("error creating OTLP metric exporter: %w", err)
+		}
+	case "stdout":
+		if spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr), stdouttrace.WithPrettyPrint()); err != nil {
+			return nil, fmt.Errorf("error creating stdout trace exporter: %w", err)
+		}
+		if metricExporter, err = stdoutmetric.New(stdoutmetric.WithWriter(os.Stderr), stdoutmetric.WithPrettyPrint()); err != nil {
+			return nil, fmt.Errorf("error creating stdout metric exporter: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown telemetry exporter %q: use \"otlp\" or \"stdout\"", cfg.Exporter)
+	}
+
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "nomi-cli"),
+		attribute.String("service.version", Version),
+	)
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter), sdktrace.WithResource(res))
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)), sdkmetric.WithResource(res))
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetMeterProvider(meterProvider)
+
+	return func(ctx context.Context) error {
+		return errors.Join(tracerProvider.Shutdown(ctx), meterProvider.Shutdown(ctx))
+	}, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestEndpointRoute(t *testing.T) {
+	tests := []struct {
+		endpoint, route, nomiID, roomID string
+	}{
+		{"/nomis", "/nomis", "", ""},
+		{"/nomis/abc", "/nomis/{id}", "abc", ""},
+		{"/nomis/abc/chat", "/nomis/{id}/chat", "abc", ""},
+		{"/rooms/r1/chat/request", "/rooms/{id}/chat/request", "", "r1"},
+	}
+
+	for _, tc := range tests {
+		route, nomiID, roomID := endpointRoute(tc.endpoint)
+		if route != tc.route || nomiID != tc.nomiID || roomID != tc.roomID {
+			t.Errorf("endpointRoute(%q) = %q, %q, %q", tc.endpoint, route, nomiID, roomID)
+		}
+	}
+}
+
+// attributeValue finds an attribute by key
+func attributeValue(attrs []attribute.KeyValue, key string) (attribute.Value, bool) {
+	for _, attr := range attrs {
+		if string(attr.Key) == key {
+			return attr.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestMakeRequestTelemetry(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	originalTracer, originalMeter := otel.GetTracerProvider(), otel.GetMeterProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	originalMetrics := clientMetrics
+	clientMetrics = newRequestMetrics(otel.Meter(instrumentationName))
+	defer func() {
+		otel.SetTracerProvider(originalTracer)
+		otel.SetMeterProvider(originalMeter)
+		clientMetrics = originalMetrics
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/nomis/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"uuid":"abc","name":"Alice"}`))
+	}))
+	defer server.Close()
+
+	c := NewNomiClient("test-api-key", server.URL)
+	if _, err := c.GetNomi("abc"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := c.GetNomi("missing"); err == nil {
+		t.Fatal("Expected an API error")
+	}
+	c.SendMessageContext(withRetryCount(context.Background(), 2), "abc", "Hi")
+
+	ended := spans.Ended()
+	if len(ended) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(ended))
+	}
+	if ended[0].Name() != "GET /nomis/{id}" {
+		t.Errorf("Unexpected span name %q", ended[0].Name())
+	}
+	if v, _ := attributeValue(ended[0].Attributes(), "nomi.uuid"); v.AsString() != "abc" {
+		t.Errorf("Expected nomi.uuid abc, got %v", v)
+	}
+	if v, _ := attributeValue(ended[0].Attributes(), "http.response.status_code"); v.AsInt64() != 200 {
+		t.Errorf("Expected status 200, got %v", v)
+	}
+	if ended[1].Status().Code != codes.Error {
+		t.Errorf("Expected the failed request's span to have error status, got %v", ended[1].Status())
+	}
+	if v, _ := attributeValue(ended[0].Attributes(), "nomi.retry.count"); v.AsInt64() != 0 {
+		t.Errorf("Expected a first attempt, got retry count %v", v)
+	}
+	if v, _ := attributeValue(ended[2].Attributes(), "nomi.retry.count"); v.AsInt64() != 2 {
+		t.Errorf("Expected retry count 2, got %v", v)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Error collecting metrics: %v", err)
+	}
+
+	found := map[string]bool{}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			found[m.Name] = true
+			if m.Name != "nomi.client.request.errors" {
+				continue
+			}
+			sum := m.Data.(metricdata.Sum[int64])
+			if len(sum.DataPoints) != 1 || sum.DataPoints[0].Value != 1 {
+				t.Fatalf("Expected a single error data point, got %+v", sum.DataPoints)
+			}
+			if v, _ := sum.DataPoints[0].Attributes.Value("error.type"); v.AsString() != "404" {
+				t.Errorf("Expected error.type 404, got %v", v)
+			}
+		}
+	}
+	if !found["nomi.client.request.duration"] || !found["nomi.client.request.errors"] {
+		t.Errorf("Expected duration and error metrics, got %v", found)
+	}
+}
+
+func TestSetupTelemetry(t *testing.T) {
+	shutdown, err := setupTelemetry(TelemetryConfig{})
+	if err != nil || shutdown(context.Background()) != nil {
+		t.Errorf("Expected disabled telemetry to be a no-op, got %v", err)
+	}
+
+	if _, err := setupTelemetry(TelemetryConfig{Exporter: "carrier-pigeon"}); err == nil {
+		t.Error("Expected an error for an unknown exporter")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+var colorMode string // --color: auto, always or never
+
+// Theme holds the styles used for all terminal output
+type Theme struct {
+	Title     lipgloss.Style // Headers such as "=== Chat Session ==="
+	Hint      lipgloss.Style // Usage instructions
+	User      lipgloss.Style // The user's name in prompts
+	Nomi      lipgloss.Style // Nomi names
+	Highlight lipgloss.Style // The selected menu entry
+	Accent    lipgloss.Style // Secondary details and the spinner
+	Code      lipgloss.Style // Code in replies
+	renderer  *lipgloss.Renderer
+}
+
+// themeRoles lists the configurable colors of a theme
+var themeRoles = []string{"title", "hint", "user", "nomi", "highlight", "accent", "code"}
+
+// builtinThemes are the palettes selectable by name, as ANSI color numbers
+// or hex values for each role.
+var builtinThemes = map[string]map[string]string{
+	"dark": {
+		"title": "3", "hint": "4", "user": "2", "nomi": "4",
+		"highlight": "2", "accent": "6", "code": "6",
+	},
+	"light": {
+		"title": "130", "hint": "25", "user": "28", "nomi": "25",
+		"highlight": "28", "accent": "30", "code": "90",
+	},
+	"high-contrast": {
+		"title": "11", "hint": "15", "user": "10", "nomi": "14",
+		"highlight": "10", "accent": "15", "code": "11",
+	},
+}
+
+// theme is the active theme, colorless until the command line is parsed
+var theme = mustTheme(ThemeConfig{}, "never")
+
+// colorProfile decides how much color to emit: --color=always and never
+// are obeyed as is, auto disables color when NO_COLOR is set or stdout is
+// not a terminal.
+func colorProfile(mode string) (termenv.Profile, error) {
+	switch mode {
+	case "never":
+		return termenv.Ascii, nil
+	case "always":
+		if colorterm := os.Getenv("COLORTERM"); colorterm == "truecolor" || colorterm == "24bit" {
+			return termenv.TrueColor, nil
+		}
+		return termenv.ANSI256, nil
+	case "", "auto":
+		if os.Getenv("NO_COLOR") != "" || !term.IsTerminal(int(os.Stdout.Fd())) {
+			return termenv.Ascii, nil
+		}
+		return termenv.NewOutput(os.Stdout).EnvColorProfile(), nil
+	default:
+		return termenv.Ascii, fmt.Errorf("invalid --color value %q: use auto, always or never", mode)
+	}
+}
+
+// newTheme builds the configured theme for the given color mode
+func newTheme(cfg ThemeConfig, mode string) (*Theme, error) {
+	profile, err := colorProfile(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = "dark"
+	}
+	base, ok := builtinThemes[name]
+	if !ok {
+		names := make([]string, 0, len(builtinThemes))
+		for n := range builtinThemes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown theme %q: use one of %s", name, strings.Join(names, ", "))
+	}
+
+	colors := map[string]string{}
+	for role, color := range base {
+		colors[role] = color
+	}
+	for role, color := range cfg.Colors {
+		if _, ok := base[role]; !ok {
+			return nil, fmt.Errorf("unknown theme color %q: use one of %s", role, strings.Join(themeRoles, ", "))
+		}
+		colors[role] = color
+	}
+
+	r := lipgloss.NewRenderer(os.Stdout)
+	r.SetColorProfile(profile)
+	style := func(role string) lipgloss.Style {
+		s := r.NewStyle().Foreground(lipgloss.Color(colors[role]))
+		if name == "high-contrast" {
+			s = s.Bold(true)
+		}
+		return s
+	}
+
+	return &Theme{
+		Title:     style("title"),
+		Hint:      style("hint"),
+		User:      style("user"),
+		Nomi:      style("nomi"),
+		Highlight: style("highlight"),
+		Accent:    style("accent"),
+		Code:      style("code"),
+		renderer:  r,
+	}, nil
+}
+
+func mustTheme(cfg ThemeConfig, mode string) *Theme {
+	t, err := newTheme(cfg, mode)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
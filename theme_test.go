@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewThemeColorModes(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+
+	// Tests don't run in a terminal, so auto means no color
+	for _, mode := range []string{"auto", "never"} {
+		th, err := newTheme(ThemeConfig{}, mode)
+		if err != nil {
+			t.Fatalf("Expected no error for %s, got %v", mode, err)
+		}
+		if out := th.Title.Render("title"); out != "title" {
+			t.Errorf("Expected no color with --color=%s, got %q", mode, out)
+		}
+	}
+
+	th, _ := newTheme(ThemeConfig{}, "always")
+	if out := th.Title.Render("title"); !strings.Contains(out, "\033[") {
+		t.Errorf("Expected color with --color=always, got %q", out)
+	}
+
+	if _, err := newTheme(ThemeConfig{}, "sometimes"); err == nil {
+		t.Error("Expected an error for an invalid color mode")
+	}
+}
+
+func TestNewThemeNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+
+	th, _ := newTheme(ThemeConfig{}, "auto")
+	if out := th.Nomi.Render("Alice"); out != "Alice" {
+		t.Errorf("Expected NO_COLOR to disable color, got %q", out)
+	}
+
+	// An explicit flag wins over the environment
+	th, _ = newTheme(ThemeConfig{}, "always")
+	if out := th.Nomi.Render("Alice"); out == "Alice" {
+		t.Error("Expected --color=always to override NO_COLOR")
+	}
+}
+
+func TestNewThemeConfig(t *testing.T) {
+	dark, _ := newTheme(ThemeConfig{}, "always")
+	light, err := newTheme(ThemeConfig{Name: "light"}, "always")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if dark.Title.Render("x") == light.Title.Render("x") {
+		t.Error("Expected the light theme to differ from the dark one")
+	}
+
+	contrast, _ := newTheme(ThemeConfig{Name: "high-contrast"}, "always")
+	if out := contrast.Hint.Render("x"); !strings.Contains(out, "1;") && !strings.Contains(out, "\033[1m") {
+		t.Errorf("Expected high-contrast text to be bold, got %q", out)
+	}
+
+	custom, err := newTheme(ThemeConfig{Colors: map[string]string{"nomi": "#ff0000"}}, "always")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if out := custom.Nomi.Render("x"); !strings.Contains(out, "255;0;0") && !strings.Contains(out, "196") {
+		t.Errorf("Expected the custom color, got %q", out)
+	}
+
+	if _, err := newTheme(ThemeConfig{Name: "neon"}, "auto"); err == nil || !strings.Contains(err.Error(), "high-contrast") {
+		t.Errorf("Expected an error listing the themes, got %v", err)
+	}
+	if _, err := newTheme(ThemeConfig{Colors: map[string]string{"border": "1"}}, "auto"); err == nil {
+		t.Error("Expected an error for an unknown color role")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceBodyLimit is the number of body bytes logged before truncation
+const traceBodyLimit = 4096
+
+const redacted = "[REDACTED]"
+
+// secretKeyPattern matches JSON keys whose values must never be logged
+var secretKeyPattern = regexp.MustCompile(`(?i)(api[_-]?key|token|secret|password|authorization)`)
+
+// messageKeyPattern matches JSON keys holding message text, kept out of log files
+var messageKeyPattern = regexp.MustCompile(`(?i)^(text|messageText)$`)
+
+// tracingTransport logs every HTTP exchange made by the client, redacting credentials.
+// Verbose mode logs the request line, status and duration; debug mode adds headers and bodies.
+type tracingTransport struct {
+	next   http.RoundTripper
+	out    io.Writer
+	debug  bool
+	secret string // API key scrubbed from anything logged
+	mu     sync.Mutex
+
+	// redactMessages hides message text from logged bodies, for logs
+	// written to disk where messages must not be kept in plaintext
+	redactMessages bool
+}
+
+func newTracingTransport(next http.RoundTripper, out io.Writer, debug bool, secret string) *tracingTransport {
+	return &tracingTransport{next: next, out: out, debug: debug, secret: secret}
+}
+
+// scrub removes the API key from arbitrary text
+func (t *tracingTransport) scrub(s string) string {
+	if t.secret == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, t.secret, redacted)
+}
+
+// redactJSON replaces the values of secret-looking keys throughout a
+// decoded JSON value, and of message text too when messages is set
+func redactJSON(v interface{}, messages bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if secretKeyPattern.MatchString(key) {
+				v[key] = redacted
+			} else if _, isText := value.(string); isText && messages && messageKeyPattern.MatchString(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactJSON(value, messages)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactJSON(value, messages)
+		}
+	}
+	return v
+}
+
+// formatBody pretty-prints and redacts a JSON body, truncating it above traceBodyLimit
+func (t *tracingTransport) formatBody(body []byte) string {
+	var decoded interface{}
+	text := string(body)
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if pretty, err := json.MarshalIndent(redactJSON(decoded, t.redactMessages), "    ", "  "); err == nil {
+			text = string(pretty)
+		}
+	} else if t.redactMessages {
+		// Only JSON can be redacted field by field
+		text = fmt.Sprintf("%s (%d bytes of non-JSON body)", redacted, len(body))
+	}
+
+	text = t.scrub(text)
+	if len(text) > traceBodyLimit {
+		text = fmt.Sprintf("%s... (truncated, %d bytes total)", text[:traceBodyLimit], len(text))
+	}
+	return text
+}
+
+// formatHeaders lists headers in a stable order with the Authorization value redacted
+func (t *tracingTransport) formatHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		for _, value := range header[name] {
+			if strings.EqualFold(name, "Authorization") {
+				scheme, _, _ := strings.Cut(value, " ")
+				value = scheme + " " + redacted
+			}
+			fmt.Fprintf(&b, "    %s: %s\n", name, t.scrub(value))
+		}
+	}
+	return b.String()
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var entry strings.Builder
+	url := t.scrub(req.URL.String())
+	fmt.Fprintf(&entry, "--> %s %s\n", req.Method, url)
+
+	if t.debug {
+		entry.WriteString(t.formatHeaders(req.Header))
+		if req.GetBody != nil {
+			if body, err := req.GetBody(); err == nil {
+				data, _ := io.ReadAll(body)
+				if len(data) > 0 {
+					fmt.Fprintf(&entry, "    %s\n", t.formatBody(data))
+				}
+			}
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	duration := time.Since(start).Round(time.Millisecond)
+
+	if err != nil {
+		fmt.Fprintf(&entry, "<-- error %s %s (%s): %s\n", req.Method, url, duration, t.scrub(err.Error()))
+		t.write(entry.String())
+		return nil, err
+	}
+
+	fmt.Fprintf(&entry, "<-- %s %s %s (%s)\n", resp.Status, req.Method, url, duration)
+	if t.debug {
+		entry.WriteString(t.formatHeaders(resp.Header))
+		data, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		if readErr != nil {
+			fmt.Fprintf(&entry, "    error reading body: %v\n", readErr)
+		} else if len(data) > 0 {
+			fmt.Fprintf(&entry, "    %s\n", t.formatBody(data))
+		}
+	}
+
+	t.write(entry.String())
+	return resp, nil
+}
+
+// write emits a complete log entry at once so concurrent requests don't interleave
+func (t *tracingTransport) write(entry string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	io.WriteString(t.out, entry)
+}
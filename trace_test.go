@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracingTransportVerbose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"nomis":[]}`))
+	}))
+	defer server.Close()
+
+	var log bytes.Buffer
+	c := NewNomiClient("secret-key-123", server.URL)
+	c.httpClient.Transport = newTracingTransport(http.DefaultTransport, &log, false, "secret-key-123")
+
+	if _, err := c.GetNomis(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	out := log.String()
+	if !strings.Contains(out, "--> GET "+server.URL+"/nomis") || !strings.Contains(out, "<-- 200 OK GET "+server.URL+"/nomis (") {
+		t.Errorf("Expected request and response lines, got %q", out)
+	}
+	if strings.Contains(out, "Authorization") || strings.Contains(out, "nomis\":") {
+		t.Errorf("Expected no headers or bodies in verbose mode, got %q", out)
+	}
+}
+
+func TestTracingTransportDebugRedacts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"sentMessage":{"uuid":"m1","text":"%s"},"replyMessage":{"uuid":"m2","text":"my key is secret-key-123"},"apiKey":"other-secret"}`, strings.Repeat("x", traceBodyLimit))
+	}))
+	defer server.Close()
+
+	var log bytes.Buffer
+	c := NewNomiClient("secret-key-123", server.URL)
+	c.httpClient.Transport = newTracingTransport(http.DefaultTransport, &log, true, "secret-key-123")
+
+	resp, err := c.SendMessage("uuid-1", "Hello")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if resp.ReplyMessage.Text != "my key is secret-key-123" {
+		t.Errorf("Expected the response body to reach the caller intact, got %q", resp.ReplyMessage.Text)
+	}
+
+	out := log.String()
+	for _, expected := range []string{
+		"Authorization: Bearer [REDACTED]",
+		"Content-Type: application/json",
+		`"messageText": "Hello"`,
+		`"apiKey": "[REDACTED]"`,
+		"my key is [REDACTED]",
+		"(truncated,",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected log to contain %q, got %q", expected, out)
+		}
+	}
+	for _, leaked := range []string{"secret-key-123", "other-secret"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("Secret %q leaked into log: %q", leaked, out)
+		}
+	}
+}
+
+func TestTracingTransportRedactsMessagesInFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"sentMessage":{"uuid":"m1","text":"Hello"},"replyMessage":{"uuid":"m2","text":"A private reply"}}`)
+	}))
+	defer server.Close()
+
+	var log bytes.Buffer
+	c := NewNomiClient("secret-key-123", server.URL)
+	transport := newTracingTransport(http.DefaultTransport, &log, true, "secret-key-123")
+	transport.redactMessages = true
+	c.httpClient.Transport = transport
+
+	if _, err := c.SendMessage("uuid-1", "Hello"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	out := log.String()
+	for _, leaked := range []string{"Hello", "A private reply"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("Message %q leaked into log: %q", leaked, out)
+		}
+	}
+	for _, expected := range []string{`"messageText": "[REDACTED]"`, `"uuid": "m2"`} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected log to contain %q, got %q", expected, out)
+		}
+	}
+}
+
+func TestTracingTransportError(t *testing.T) {
+	var log bytes.Buffer
+	c := NewNomiClient("secret-key-123", "http://127.0.0.1:1")
+	c.httpClient.Transport = newTracingTransport(http.DefaultTransport, &log, false, "secret-key-123")
+
+	if _, err := c.GetNomis(); err == nil {
+		t.Fatal("Expected a connection error")
+	}
+	if !strings.Contains(log.String(), "<-- error GET http://127.0.0.1:1/nomis") {
+		t.Errorf("Expected an error line, got %q", log.String())
+	}
+}
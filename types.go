@@ -27,3 +27,11 @@ type Room struct {
 type RoomResponse struct {
 	Rooms []Room `json:"rooms"`
 }
+
+// RoomRequest holds the settings of a room to create or update
+type RoomRequest struct {
+	Name                  string   `json:"name"`
+	Note                  string   `json:"note"`
+	BackchannelingEnabled bool     `json:"backchannelingEnabled"`
+	NomiUUIDs             []string `json:"nomiUuids"`
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Events reported by watch
+const (
+	eventRoomCreated = "room.created"
+	eventRoomDeleted = "room.deleted"
+	eventRoomStatus  = "room.status"
+	eventRoomMembers = "room.members"
+	eventNomiAdded   = "nomi.added"
+	eventNomiRemoved = "nomi.removed"
+)
+
+var watchInterval time.Duration    // Time between polls
+var watchMaxInterval time.Duration // Longest wait between polls after failures
+var watchJSON bool                 // Print events as JSON lines
+
+// watchEvent is a change noticed between two polls of the account
+type watchEvent struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	RoomUUID string    `json:"roomUuid,omitempty"`
+	RoomName string    `json:"roomName,omitempty"`
+	NomiUUID string    `json:"nomiUuid,omitempty"`
+	NomiName string    `json:"nomiName,omitempty"`
+	From     string    `json:"from,omitempty"` // Previous status
+	To       string    `json:"to,omitempty"`   // New status
+	Added    []string  `json:"added,omitempty"`
+	Removed  []string  `json:"removed,omitempty"`
+}
+
+// String describes an event on one line for the terminal
+func (e watchEvent) String() string {
+	var what string
+	switch e.Event {
+	case eventRoomCreated:
+		what = fmt.Sprintf("Room %s created (members: %s)", e.RoomName, strings.Join(e.Added, ", "))
+	case eventRoomDeleted:
+		what = fmt.Sprintf("Room %s deleted", e.RoomName)
+	case eventRoomStatus:
+		what = fmt.Sprintf("Room %s status: %s → %s", e.RoomName, e.From, e.To)
+	case eventRoomMembers:
+		var changes []string
+		for _, name := range e.Added {
+			changes = append(changes, "+"+name)
+		}
+		for _, name := range e.Removed {
+			changes = append(changes, "-"+name)
+		}
+		what = fmt.Sprintf("Room %s members: %s", e.RoomName, strings.Join(changes, ", "))
+	case eventNomiAdded:
+		what = fmt.Sprintf("Nomi %s added", e.NomiName)
+	case eventNomiRemoved:
+		what = fmt.Sprintf("Nomi %s removed", e.NomiName)
+	}
+	return theme.Hint.Render(e.Time.Local().Format("15:04:05")) + " " + what
+}
+
+// watchState is the account as seen by the last successful poll
+type watchState struct {
+	rooms map[string]Room
+	nomis map[string]Nomi
+}
+
+// update records a new poll and returns the events since the previous
+// one. The first poll only sets the baseline.
+func (s *watchState) update(rooms []Room, nomis []Nomi, now time.Time) []watchEvent {
+	previousRooms, previousNomis := s.rooms, s.nomis
+	s.rooms = map[string]Room{}
+	for _, room := range rooms {
+		s.rooms[room.UUID] = room
+	}
+	s.nomis = map[string]Nomi{}
+	for _, nomi := range nomis {
+		s.nomis[nomi.UUID] = nomi
+	}
+	if previousRooms == nil {
+		return nil
+	}
+
+	var events []watchEvent
+	for _, nomi := range nomis {
+		if _, ok := previousNomis[nomi.UUID]; !ok {
+			events = append(events, watchEvent{Event: eventNomiAdded, Time: now, NomiUUID: nomi.UUID, NomiName: nomi.Name})
+		}
+	}
+	for _, uuid := range sortedKeys(previousNomis) {
+		if _, ok := s.nomis[uuid]; !ok {
+			events = append(events, watchEvent{Event: eventNomiRemoved, Time: now, NomiUUID: uuid, NomiName: previousNomis[uuid].Name})
+		}
+	}
+
+	for _, room := range rooms {
+		event := watchEvent{Time: now, RoomUUID: room.UUID, RoomName: room.Name}
+		old, ok := previousRooms[room.UUID]
+		if !ok {
+			event.Event, event.Added = eventRoomCreated, memberNames(room)
+			events = append(events, event)
+			continue
+		}
+		if old.Status != room.Status {
+			event.Event, event.From, event.To = eventRoomStatus, old.Status, room.Status
+			events = append(events, event)
+		}
+
+		before, after := memberNames(old), memberNames(room)
+		event = watchEvent{Event: eventRoomMembers, Time: now, RoomUUID: room.UUID, RoomName: room.Name}
+		for _, name := range after {
+			if !containsString(before, name) {
+				event.Added = append(event.Added, name)
+			}
+		}
+		for _, name := range before {
+			if !containsString(after, name) {
+				event.Removed = append(event.Removed, name)
+			}
+		}
+		if len(event.Added) > 0 || len(event.Removed) > 0 {
+			events = append(events, event)
+		}
+	}
+	for _, uuid := range sortedKeys(previousRooms) {
+		if _, ok := s.rooms[uuid]; !ok {
+			events = append(events, watchEvent{Event: eventRoomDeleted, Time: now, RoomUUID: uuid, RoomName: previousRooms[uuid].Name})
+		}
+	}
+	return events
+}
+
+// sortedKeys returns the keys of a map in order, for stable output
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// watchDelay returns the wait before the next poll: the interval, doubled
+// for each consecutive failure up to max, with ±10% jitter so that several
+// watchers don't poll in lockstep
+func watchDelay(interval, max time.Duration, failures int) time.Duration {
+	delay := interval
+	for i := 0; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return time.Duration(float64(delay) * (0.9 + 0.2*rand.Float64()))
+}
+
+// watch polls the account until ctx is done, writing events to out and
+// poll errors to errOut
+func watch(ctx context.Context, out, errOut io.Writer, interval, max time.Duration, asJSON bool) {
+	state := &watchState{}
+	encoder := json.NewEncoder(out)
+	failures := 0
+	for {
+		rooms, err := client.GetRooms()
+		var nomis []Nomi
+		if err == nil {
+			nomis, err = client.GetNomis()
+		}
+
+		if err != nil {
+			failures++
+		} else {
+			failures = 0
+			for _, event := range state.update(rooms, nomis, time.Now()) {
+				if asJSON {
+					encoder.Encode(event)
+				} else {
+					fmt.Fprintln(out, event)
+				}
+			}
+		}
+
+		delay := watchDelay(interval, max, failures)
+		if err != nil {
+			fmt.Fprintf(errOut, "Error polling account: %v (retrying in %s)\n", err, delay.Round(time.Second))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Print changes to your rooms and Nomis as they happen",
+	Long: `Poll the account and print an event when a room is created or deleted, changes
+status or membership, or when a Nomi is added or removed. With --json, each
+event is printed as a JSON line for other tools to consume.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if watchInterval <= 0 || watchMaxInterval < watchInterval {
+			fmt.Println("Error: --interval must be positive and no longer than --max-interval")
+			return
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// Keep stdout for events when they are piped to another tool
+		if !watchJSON {
+			fmt.Printf("Watching rooms and Nomis every %s, press Ctrl+C to stop\n", watchInterval)
+		}
+		watch(ctx, os.Stdout, os.Stderr, watchInterval, watchMaxInterval, watchJSON)
+	},
+}
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 30*time.Second, "Time between polls")
+	watchCmd.Flags().DurationVar(&watchMaxInterval, "max-interval", 5*time.Minute, "Longest wait between polls when the API keeps failing")
+	watchCmd.Flags().BoolVar(&watchJSON, "json", false, "Print events as JSON lines")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchStateUpdate(t *testing.T) {
+	alice := Nomi{UUID: "uuid-alice", Name: "Alice"}
+	bob := Nomi{UUID: "uuid-bob", Name: "Bob"}
+	carol := Nomi{UUID: "uuid-carol", Name: "Carol"}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	state := &watchState{}
+	rooms := []Room{
+		{UUID: "room-book", Name: "Book Club", Status: "Default", Nomis: []Nomi{alice, bob}},
+		{UUID: "room-old", Name: "Old Room", Status: "Default", Nomis: []Nomi{alice}},
+	}
+	if events := state.update(rooms, []Nomi{alice, bob}, now); len(events) != 0 {
+		t.Fatalf("Expected the first poll to only set the baseline, got %+v", events)
+	}
+	if events := state.update(rooms, []Nomi{alice, bob}, now); len(events) != 0 {
+		t.Fatalf("Expected no events without changes, got %+v", events)
+	}
+
+	rooms = []Room{
+		{UUID: "room-book", Name: "Book Club", Status: "Waiting", Nomis: []Nomi{alice, carol}},
+		{UUID: "room-new", Name: "New Room", Status: "Default", Nomis: []Nomi{carol}},
+	}
+	events := state.update(rooms, []Nomi{alice, bob, carol}, now)
+
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Event)
+	}
+	expected := []string{eventNomiAdded, eventRoomStatus, eventRoomMembers, eventRoomCreated, eventRoomDeleted}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Expected events %v, got %v", expected, got)
+	}
+	if events[0].NomiName != "Carol" {
+		t.Errorf("Expected Carol to be added, got %+v", events[0])
+	}
+	if events[1].From != "Default" || events[1].To != "Waiting" {
+		t.Errorf("Expected a status change from Default to Waiting, got %+v", events[1])
+	}
+	if strings.Join(events[2].Added, ",") != "Carol" || strings.Join(events[2].Removed, ",") != "Bob" {
+		t.Errorf("Expected +Carol -Bob, got %+v", events[2])
+	}
+	if events[4].RoomName != "Old Room" {
+		t.Errorf("Expected Old Room to be deleted, got %+v", events[4])
+	}
+	if line := events[2].String(); !strings.Contains(line, "Room Book Club members: +Carol, -Bob") {
+		t.Errorf("Expected a readable membership change, got %q", line)
+	}
+}
+
+func TestWatchDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 20 * time.Second},
+		{2, 40 * time.Second},
+		{10, time.Minute}, // Capped at the maximum
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			delay := watchDelay(10*time.Second, time.Minute, tt.failures)
+			min, max := tt.expected*9/10, tt.expected*11/10
+			if delay < min || delay > max {
+				t.Errorf("Expected a delay within 10%% of %s after %d failures, got %s", tt.expected, tt.failures, delay)
+			}
+		}
+	}
+}
+
+func TestWatchEmitsJSON(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/rooms":
+			polls++
+			switch {
+			case polls == 2:
+				// A failed poll is retried without losing the baseline
+				w.WriteHeader(http.StatusInternalServerError)
+			case polls > 2:
+				json.NewEncoder(w).Encode(RoomResponse{Rooms: []Room{{UUID: "room-book", Name: "Book Club"}}})
+			default:
+				json.NewEncoder(w).Encode(RoomResponse{Rooms: []Room{}})
+			}
+		case "/nomis":
+			json.NewEncoder(w).Encode(NomiResponse{Nomis: []Nomi{}})
+		}
+	}))
+	defer server.Close()
+	client = NewNomiClient("test-api-key", server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	var out, errOut bytes.Buffer
+	watch(ctx, &out, &errOut, 10*time.Millisecond, 20*time.Millisecond, true)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected a single event, got %q", out.String())
+	}
+	var event watchEvent
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+		t.Fatalf("Expected a JSON event, got %q: %v", lines[0], err)
+	}
+	if event.Event != eventRoomCreated || event.RoomName != "Book Club" {
+		t.Errorf("Expected Book Club to be created, got %+v", event)
+	}
+	if !strings.Contains(errOut.String(), "Error polling account") {
+		t.Errorf("Expected the failed poll to be reported, got %q", errOut.String())
+	}
+}